@@ -0,0 +1,102 @@
+package zapcloudwatch
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"go.uber.org/zap/zapcore"
+)
+
+// ErrNotSent is acknowledged for entries AddEntryAck was given at a level
+// the hook doesn't send.
+var ErrNotSent = errors.New("zapcloudwatch: entry not sent at its level")
+
+// ErrPausedDrop is acknowledged for entries dropped while the hook was
+// paused.
+var ErrPausedDrop = errors.New("zapcloudwatch: entry dropped while paused")
+
+// ackSet holds the acks of the events waiting for their put
+type ackSet struct {
+	mu sync.Mutex
+	m  map[*cloudwatchlogs.InputLogEvent]*entryAck
+}
+
+// entryAck is told the outcome of an entry's delivery exactly once
+type entryAck struct {
+	c    chan error
+	once sync.Once
+	// handed is set once the ack was handed on to what tells it: the put
+	// holding the entry, or a fan-out waiting on its copies. Errors the
+	// write returns after that may be of other batches.
+	handed atomic.Bool
+}
+
+func newEntryAck() *entryAck {
+	return &entryAck{c: make(chan error, 1)}
+}
+
+// tell sends err, unless the ack was told already. c holds that one value,
+// so tell never blocks.
+func (a *entryAck) tell(err error) {
+	a.once.Do(func() { a.c <- err })
+}
+
+// fail tells err, the error of a write that didn't hand the ack on
+func (a *entryAck) fail(err error) {
+	if !a.handed.Load() {
+		a.tell(err)
+	}
+}
+
+// AddEntryAck is AddEntry for entries that must be known to be delivered.
+// The returned channel receives a single value: nil once cloudwatch has
+// accepted the put holding the entry, or the error that kept it from
+// being delivered. Entries that went to the fallback writer instead count
+// as undelivered.
+//
+//	if err := <-hook.AddEntryAck(entry); err != nil {
+//		// retry or raise an alarm
+//	}
+func (ch *CloudwatchHook) AddEntryAck(entry zapcore.Entry) <-chan error {
+	ack := newEntryAck()
+	if err := ch.writeEntryAck(entry, ack); err != nil {
+		ack.fail(err)
+	}
+	return ack.c
+}
+
+// watchAck has ack told the outcome of the put holding event
+func (ch *CloudwatchHook) watchAck(event *cloudwatchlogs.InputLogEvent, ack *entryAck) {
+	ack.handed.Store(true)
+
+	ch.acks.mu.Lock()
+	defer ch.acks.mu.Unlock()
+
+	if ch.acks.m == nil {
+		ch.acks.m = make(map[*cloudwatchlogs.InputLogEvent]*entryAck)
+	}
+	ch.acks.m[event] = ack
+}
+
+// acknowledge tells those waiting on any of the events the outcome of their
+// put
+func (ch *CloudwatchHook) acknowledge(events []*cloudwatchlogs.InputLogEvent, err error) {
+	ch.acks.mu.Lock()
+	var acks []*entryAck
+	for _, event := range events {
+		if len(ch.acks.m) == 0 {
+			break
+		}
+		if ack, ok := ch.acks.m[event]; ok {
+			delete(ch.acks.m, event)
+			acks = append(acks, ack)
+		}
+	}
+	ch.acks.mu.Unlock()
+
+	for _, ack := range acks {
+		ack.tell(err)
+	}
+}
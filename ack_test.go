@@ -0,0 +1,87 @@
+package zapcloudwatch
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"go.uber.org/zap/zapcore"
+)
+
+// waitAck returns what ack is told, failing the test if it takes too long
+func waitAck(t *testing.T, ack <-chan error) error {
+	t.Helper()
+	select {
+	case err := <-ack:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("ack never told")
+		return nil
+	}
+}
+
+func TestAddEntryAck(t *testing.T) {
+	errPut := errors.New("put failed")
+	tests := []struct {
+		name  string
+		level zapcore.Level
+		put   error
+		want  error
+	}{
+		{"delivered", zapcore.InfoLevel, nil, nil},
+		{"put failed", zapcore.InfoLevel, errPut, errPut},
+		{"not sent", zapcore.DebugLevel, nil, ErrNotSent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &mockLogs{onPut: func(*cloudwatchlogs.PutLogEventsInput) error { return tt.put }}
+			m.addStream("group", "stream")
+			hook := &CloudwatchHook{GroupName: "group", StreamName: "stream", Client: m,
+				LevelEnabler: zapcore.InfoLevel, OnError: func(error) {}}
+			ack := hook.AddEntryAck(zapcore.Entry{Time: time.Now(), Level: tt.level, Message: "hi"})
+			if err := waitAck(t, ack); !errors.Is(err, tt.want) {
+				t.Errorf("acked %v, want %v", err, tt.want)
+			}
+			// told once
+			select {
+			case err := <-ack:
+				t.Errorf("acked again with %v", err)
+			default:
+			}
+			hook.Close()
+		})
+	}
+}
+
+func TestAckOtherBatchError(t *testing.T) {
+	errPut := errors.New("put failed")
+	puts := 0
+	m := &mockLogs{onPut: func(*cloudwatchlogs.PutLogEventsInput) error {
+		if puts++; puts == 1 {
+			return errPut
+		}
+		return nil
+	}}
+	m.addStream("group", "stream")
+	hook := &CloudwatchHook{GroupName: "group", StreamName: "stream", Client: m,
+		FlushInterval: time.Hour, OnError: func(error) {}}
+
+	// too big to share a put, so the ack's entry pushes the first one out,
+	// whose put fails
+	big := strings.Repeat("a", 600*1024)
+	hook.AddMessage(zapcore.InfoLevel, big)
+	ack := hook.AddEntryAck(zapcore.Entry{Time: time.Now(), Level: zapcore.InfoLevel, Message: big})
+
+	closed := make(chan error, 1)
+	go func() { closed <- hook.Close() }()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close blocked acknowledging the entry")
+	}
+	if err := waitAck(t, ack); err != nil {
+		t.Errorf("acked %v, the error of another batch", err)
+	}
+}
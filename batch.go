@@ -0,0 +1,187 @@
+package zapcloudwatch
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+)
+
+// maxBatchBytes and maxBatchEvents are the most a single PutLogEvents call
+// accepts. Bytes count every message plus eventOverhead.
+const (
+	maxBatchBytes  = 1024 * 1024
+	maxBatchEvents = 10000
+)
+
+// batching reports whether events are buffered before being put
+func (ch *CloudwatchHook) batching() bool {
+	return ch.BatchSize > 0 || ch.FlushInterval > 0 || ch.AdaptiveBatching
+}
+
+// flushBytes is the buffer size at which it is put: FlushBytesThresholdPct
+// of maxBatchBytes, or all of it
+func (ch *CloudwatchHook) flushBytes() int {
+	if ch.FlushBytesThresholdPct > 0 && ch.FlushBytesThresholdPct < 100 {
+		return maxBatchBytes * ch.FlushBytesThresholdPct / 100
+	}
+	return maxBatchBytes
+}
+
+// eventSize is what an event counts towards maxBatchBytes
+func eventSize(event *cloudwatchlogs.InputLogEvent) int {
+	return len(aws.StringValue(event.Message)) + eventOverhead
+}
+
+// batchIDSample is as long as the most tagging adds to a message: a
+// separator and a {"batch_id":"…"} object holding a UUID
+const batchIDSample = ` {"batch_id":"00000000-0000-4000-8000-000000000000"}`
+
+// bufferedSize is what an event counts towards maxBatchBytes once it is put:
+// with its batch id, and as an item of a packed event, escaped and with its
+// separator or brackets, when PackBatchAsSingleEvent is set
+func (ch *CloudwatchHook) bufferedSize(event *cloudwatchlogs.InputLogEvent) int {
+	msg := aws.StringValue(event.Message)
+	if ch.BatchIDs {
+		msg += batchIDSample
+	}
+	if !ch.PackBatchAsSingleEvent {
+		return len(msg) + eventOverhead
+	}
+	item, err := json.Marshal(archivedEvent{Timestamp: aws.Int64Value(event.Timestamp), Message: msg})
+	if err != nil {
+		return len(msg) + eventOverhead
+	}
+	return len(item) + 2 + eventOverhead
+}
+
+// enqueue buffers an event, putting the buffer once it reaches BatchSize or
+// the limits of a single put. The flush timer is armed by the first event
+// of each batch.
+func (ch *CloudwatchHook) enqueue(event *cloudwatchlogs.InputLogEvent) error {
+	ch.bufMu.Lock()
+	// an event that doesn't fit goes into a batch of its own
+	var full []*cloudwatchlogs.InputLogEvent
+	var fullSegment string
+	if !ch.fits(event) {
+		full, fullSegment = ch.takeBuffer()
+	}
+
+	ch.buffer(event)
+	expired := false
+	if len(ch.buf) == 1 {
+		if delay, ok := ch.flushDelay(event); ok && delay <= 0 {
+			expired = true
+		} else if ok {
+			ch.flushTimer = time.AfterFunc(delay, ch.flushTimed)
+		}
+	}
+	var batch []*cloudwatchlogs.InputLogEvent
+	var segment string
+	if expired || (ch.BatchSize > 0 && len(ch.buf) >= ch.BatchSize) || ch.bufBytes >= ch.flushBytes() || len(ch.buf) >= maxBatchEvents {
+		batch, segment = ch.takeBuffer()
+	}
+	ch.bufMu.Unlock()
+
+	var err error
+	if len(full) > 0 {
+		err = ch.deliver(full, fullSegment)
+	}
+	if len(batch) > 0 {
+		if berr := ch.deliver(batch, segment); err == nil {
+			err = berr
+		}
+	}
+	return err
+}
+
+// fits reports whether event can join the buffer without the batch going
+// over the limits of a single put. bufMu must be held.
+func (ch *CloudwatchHook) fits(event *cloudwatchlogs.InputLogEvent) bool {
+	return len(ch.buf) == 0 || (ch.bufBytes+ch.bufferedSize(event) <= maxBatchBytes && len(ch.buf) < maxBatchEvents)
+}
+
+// flushDelay returns how long a batch starting with first may be held before
+// it is put: FlushInterval, or until the next multiple of it on the clock
+// with AlignFlushToClock, cut short so first is put before it is older than
+// MaxEventAge. It reports false if the batch may wait until it is full.
+func (ch *CloudwatchHook) flushDelay(first *cloudwatchlogs.InputLogEvent) (time.Duration, bool) {
+	delay, ok := ch.FlushInterval, ch.FlushInterval > 0
+	if ok && ch.AlignFlushToClock {
+		now := time.Now()
+		delay = now.Truncate(ch.FlushInterval).Add(ch.FlushInterval).Sub(now)
+	}
+	if ch.MaxEventAge > 0 {
+		emitted := time.UnixMilli(aws.Int64Value(first.Timestamp))
+		if left := time.Until(emitted.Add(ch.MaxEventAge)); !ok || left < delay {
+			delay, ok = left, true
+		}
+	}
+	return delay, ok
+}
+
+// buffer appends an event to the buffer and the active spool segment.
+// bufMu must be held.
+func (ch *CloudwatchHook) buffer(event *cloudwatchlogs.InputLogEvent) {
+	ch.buf = append(ch.buf, event)
+	ch.bufBytes += ch.bufferedSize(event)
+	if err := ch.spool.append(event); err != nil {
+		ch.reportError(err)
+	}
+}
+
+// takeBuffer empties the buffer and stops its flush timer, returning the
+// spool segment holding the batch. bufMu must be held.
+func (ch *CloudwatchHook) takeBuffer() ([]*cloudwatchlogs.InputLogEvent, string) {
+	batch := ch.buf
+	ch.buf = nil
+	ch.bufBytes = 0
+	if ch.flushTimer != nil {
+		ch.flushTimer.Stop()
+		ch.flushTimer = nil
+	}
+	return batch, ch.spool.rotate()
+}
+
+// flushBuffer synchronously puts whatever is buffered
+func (ch *CloudwatchHook) flushBuffer() error {
+	ch.bufMu.Lock()
+	batch, segment := ch.takeBuffer()
+	ch.bufMu.Unlock()
+
+	if len(batch) == 0 {
+		return nil
+	}
+	return ch.sendEvent(batch, segment)
+}
+
+func (ch *CloudwatchHook) flushTimed() {
+	defer ch.pending.done(ch.pending.start())
+	ch.flushBuffer()
+}
+
+// sendNow synchronously puts the buffer followed by event. It doesn't wait
+// for asynchronous sends, one of which may be logging event from OnError;
+// a put of theirs already under way holds the stream's lock, which this
+// put queues behind.
+func (ch *CloudwatchHook) sendNow(event *cloudwatchlogs.InputLogEvent) error {
+	ch.bufMu.Lock()
+	var full []*cloudwatchlogs.InputLogEvent
+	var fullSegment string
+	if !ch.fits(event) {
+		full, fullSegment = ch.takeBuffer()
+	}
+	ch.buffer(event)
+	batch, segment := ch.takeBuffer()
+	ch.bufMu.Unlock()
+
+	var err error
+	if len(full) > 0 {
+		err = ch.sendEvent(full, fullSegment)
+	}
+	if serr := ch.sendEvent(batch, segment); err == nil {
+		err = serr
+	}
+	return err
+}
@@ -0,0 +1,240 @@
+package zapcloudwatch
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestFlushIntervalSingleEntry(t *testing.T) {
+	const interval = 50 * time.Millisecond
+	sink := &memSink{}
+	hook := &CloudwatchHook{Sink: sink, BatchSize: 100, FlushInterval: interval}
+	if _, err := hook.GetHook(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, msg := range []string{"first", "second"} {
+		start := time.Now()
+		if err := hook.write(zapcore.Entry{Level: zapcore.InfoLevel, Message: msg}); err != nil {
+			t.Fatal(err)
+		}
+		n := len(sink.messages())
+		waitFor(t, msg+" to be put", func() bool { return len(sink.messages()) == n+1 })
+		if elapsed := time.Since(start); elapsed > 4*interval {
+			t.Errorf("%s was put after %v, want about %v", msg, elapsed, interval)
+		}
+	}
+	if n := sink.puts(); n != 2 {
+		t.Fatalf("got %d puts, want one per interval", n)
+	}
+}
+
+func TestMaxEventAge(t *testing.T) {
+	const age = 50 * time.Millisecond
+	tests := []struct {
+		name     string
+		interval time.Duration
+	}{
+		{"without FlushInterval", 0},
+		{"shorter than FlushInterval", time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := &memSink{}
+			hook := &CloudwatchHook{Sink: sink, BatchSize: 100, FlushInterval: tt.interval, MaxEventAge: age}
+
+			start := time.Now()
+			hook.AddMessage(zapcore.InfoLevel, "first")
+			time.Sleep(age / 2)
+			hook.AddMessage(zapcore.InfoLevel, "second")
+			waitFor(t, "the batch to be put", func() bool { return sink.puts() == 1 })
+			if elapsed := time.Since(start); elapsed > 4*age {
+				t.Errorf("batch was put after %v, want within about %v of its first event", elapsed, age)
+			}
+			if got := sink.messages(); len(got) != 2 {
+				t.Errorf("put %q, want both events in one batch", got)
+			}
+		})
+	}
+}
+
+// slowSink counts how many puts are in progress at once
+type slowSink struct {
+	mu        sync.Mutex
+	inFlight  int
+	max       int
+	delivered int
+}
+
+func (s *slowSink) Put(events []*cloudwatchlogs.InputLogEvent) error {
+	s.mu.Lock()
+	s.inFlight++
+	if s.inFlight > s.max {
+		s.max = s.inFlight
+	}
+	s.mu.Unlock()
+
+	time.Sleep(5 * time.Millisecond)
+
+	s.mu.Lock()
+	s.inFlight--
+	s.delivered += len(events)
+	s.mu.Unlock()
+	return nil
+}
+
+func TestMaxInFlightBatches(t *testing.T) {
+	sink := &slowSink{}
+	hook := &CloudwatchHook{Sink: sink, Async: true, BatchSize: 1, MaxInFlightBatches: 2}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				hook.AddMessage(zapcore.InfoLevel, "event")
+			}
+		}()
+	}
+	wg.Wait()
+	hook.Close()
+
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	if sink.max > 2 {
+		t.Errorf("%d puts were in flight at once, want at most 2", sink.max)
+	}
+	if sink.max < 2 {
+		t.Errorf("at most %d put was in flight, want async puts to overlap", sink.max)
+	}
+	if sink.delivered != 40 {
+		t.Errorf("delivered %d events, want 40", sink.delivered)
+	}
+}
+
+func TestAdaptiveBatchingLimits(t *testing.T) {
+	// mixed sizes, half of them quotes that double when packing escapes them
+	var msgs []string
+	for i := 0; i < 120; i++ {
+		size := []int{120, 9000, 40000}[i%3]
+		msgs = append(msgs, strings.Repeat("a", size/2)+strings.Repeat(`"`, size/2))
+	}
+	tests := []struct {
+		name string
+		hook *CloudwatchHook
+	}{
+		{"plain", &CloudwatchHook{AdaptiveBatching: true}},
+		{"batch ids", &CloudwatchHook{AdaptiveBatching: true, BatchIDs: true}},
+		{"packed", &CloudwatchHook{AdaptiveBatching: true, PackBatchAsSingleEvent: true}},
+		{"packed batch ids", &CloudwatchHook{AdaptiveBatching: true, PackBatchAsSingleEvent: true, BatchIDs: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := &memSink{}
+			hook := tt.hook
+			hook.Sink = sink
+			for _, msg := range msgs {
+				if err := hook.write(zapcore.Entry{Level: zapcore.InfoLevel, Message: msg}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			hook.Close()
+
+			sink.mu.Lock()
+			defer sink.mu.Unlock()
+			if len(sink.batches) < 2 {
+				t.Fatalf("got %d puts, want the events split", len(sink.batches))
+			}
+			for i, batch := range sink.batches {
+				size := 0
+				for _, event := range batch {
+					size += eventSize(event)
+				}
+				if size > maxBatchBytes {
+					t.Errorf("put %d is %d bytes, over %d", i, size, maxBatchBytes)
+				}
+				// all but the last are full up to about the largest event
+				if i < len(sink.batches)-1 && size < maxBatchBytes-2*40000-1024 {
+					t.Errorf("put %d is %d bytes, want it packed close to %d", i, size, maxBatchBytes)
+				}
+			}
+		})
+	}
+}
+
+func TestAlignFlushToClock(t *testing.T) {
+	const interval = 200 * time.Millisecond
+	hook := &CloudwatchHook{FlushInterval: interval, AlignFlushToClock: true}
+	first := &cloudwatchlogs.InputLogEvent{Timestamp: aws.Int64(time.Now().UnixMilli())}
+	for i := 0; i < 5; i++ {
+		delay, ok := hook.flushDelay(first)
+		at := time.Now().Add(delay)
+		if !ok || delay <= 0 || delay > interval {
+			t.Fatalf("delay %v, want up to %v", delay, interval)
+		}
+		if off := at.Sub(at.Round(interval)); off > 5*time.Millisecond || off < -5*time.Millisecond {
+			t.Errorf("flushing at %v, %v off a multiple of %v", at, off, interval)
+		}
+		time.Sleep(interval / 3)
+	}
+
+	// MaxEventAge still cuts the wait short
+	hook.MaxEventAge = 20 * time.Millisecond
+	if delay, _ := hook.flushDelay(first); delay > hook.MaxEventAge {
+		t.Errorf("delay %v, want it within MaxEventAge", delay)
+	}
+
+	// a buffered event is put on the next multiple of the interval
+	sink := &memSink{}
+	hook = &CloudwatchHook{Sink: sink, FlushInterval: interval, AlignFlushToClock: true}
+	if err := hook.write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "tick"}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the flush", func() bool { return len(sink.messages()) == 1 })
+	putAt := time.Now()
+	if off := putAt.Sub(putAt.Truncate(interval)); off > 50*time.Millisecond {
+		t.Errorf("put %v after a multiple of %v", off, interval)
+	}
+	hook.Close()
+}
+
+func TestFlushBytesThresholdPct(t *testing.T) {
+	const size = 100 * 1024
+	msg := strings.Repeat("x", size-len("[] "))
+	tests := []struct {
+		pct  int
+		want int // events per put
+	}{
+		{50, 6},
+		{80, 9},
+		// out of range means the 1 MB limit
+		{0, 10},
+		{100, 10},
+	}
+	for _, tt := range tests {
+		sink := &memSink{}
+		hook := &CloudwatchHook{Sink: sink, AdaptiveBatching: true, FlushBytesThresholdPct: tt.pct}
+		for i := 0; i < 3*tt.want; i++ {
+			if err := hook.write(zapcore.Entry{Level: zapcore.InfoLevel, Message: msg}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		hook.Close()
+		sink.mu.Lock()
+		var sizes []int
+		for _, batch := range sink.batches {
+			sizes = append(sizes, len(batch))
+		}
+		sink.mu.Unlock()
+		if fmt.Sprint(sizes) != fmt.Sprint([]int{tt.want, tt.want, tt.want}) {
+			t.Errorf("%d%%: put batches of %v events, want %d each", tt.pct, sizes, tt.want)
+		}
+	}
+}
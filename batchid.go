@@ -0,0 +1,33 @@
+package zapcloudwatch
+
+import (
+	"crypto/rand"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+)
+
+// batchIDKey is the field holding the id BatchIDs adds
+const batchIDKey = "batch_id"
+
+// newBatchID returns a random version 4 UUID
+func newBatchID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// tagBatch returns copies of the events with one new batch id added to
+// each message, as appendFields adds it.
+func (ch *CloudwatchHook) tagBatch(events []*cloudwatchlogs.InputLogEvent) []*cloudwatchlogs.InputLogEvent {
+	id := newBatchID()
+	tagged := make([]*cloudwatchlogs.InputLogEvent, len(events))
+	for i, event := range events {
+		msg := ch.appendFields(aws.StringValue(event.Message), batchIDKey, id)
+		tagged[i] = &cloudwatchlogs.InputLogEvent{Message: aws.String(msg), Timestamp: event.Timestamp}
+	}
+	return tagged
+}
@@ -0,0 +1,46 @@
+package zapcloudwatch
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestBatchIDs(t *testing.T) {
+	sink := &memSink{}
+	hook := &CloudwatchHook{Sink: sink, BatchIDs: true, BatchSize: 3, FlushInterval: time.Hour}
+	for _, msg := range []string{"a", "b", "c", "d", "e", "f"} {
+		if err := hook.write(zapcore.Entry{Level: zapcore.InfoLevel, Message: msg}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	hook.Close()
+
+	uuid := regexp.MustCompile(`^\[\] [a-f] \{"batch_id":"([0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12})"\}$`)
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	if len(sink.batches) != 2 {
+		t.Fatalf("got %d batches, want 2", len(sink.batches))
+	}
+	var ids []string
+	for i, batch := range sink.batches {
+		var id string
+		for _, event := range batch {
+			m := uuid.FindStringSubmatch(aws.StringValue(event.Message))
+			if m == nil {
+				t.Fatalf("batch %d: message %q has no batch id", i, aws.StringValue(event.Message))
+			}
+			if id != "" && m[1] != id {
+				t.Errorf("batch %d has ids %s and %s, want one", i, id, m[1])
+			}
+			id = m[1]
+		}
+		ids = append(ids, id)
+	}
+	if ids[0] == ids[1] {
+		t.Errorf("both batches got id %s", ids[0])
+	}
+}
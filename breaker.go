@@ -0,0 +1,104 @@
+package zapcloudwatch
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned when an event is not sent because the circuit
+// breaker is open and no fallback writer is configured.
+var ErrCircuitOpen = errors.New("zapcloudwatch: circuit breaker is open")
+
+// BreakerState is the state of the hook's circuit breaker
+type BreakerState int
+
+const (
+	// BreakerClosed lets every put through to cloudwatch.
+	BreakerClosed BreakerState = iota
+	// BreakerOpen sends events straight to the fallback writer.
+	BreakerOpen
+	// BreakerHalfOpen lets a single probe through to check for recovery.
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+type circuitBreaker struct {
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// allow reports whether a put may be attempted. Once the cooldown has passed
+// an open breaker becomes half-open and lets exactly one probe through.
+func (b *circuitBreaker) allow(threshold int, cooldown time.Duration) bool {
+	if threshold <= 0 {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < cooldown {
+			return false
+		}
+		b.state = BreakerHalfOpen
+		b.probing = true
+		return true
+	case BreakerHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	}
+	return true
+}
+
+// record updates the breaker with the outcome of a put.
+func (b *circuitBreaker) record(ok bool, threshold int) {
+	if threshold <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if ok {
+		b.state = BreakerClosed
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= threshold {
+		b.state = BreakerOpen
+		b.openedAt = time.Now()
+	}
+}
+
+func (b *circuitBreaker) current(cooldown time.Duration) BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerOpen && time.Since(b.openedAt) >= cooldown {
+		return BreakerHalfOpen
+	}
+	return b.state
+}
@@ -0,0 +1,123 @@
+package zapcloudwatch
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestBreakerOpenFallback(t *testing.T) {
+	events := []*cloudwatchlogs.InputLogEvent{{Message: aws.String("[] one")}, {Message: aws.String("[] two")}}
+
+	// an open breaker puts nothing, so the hook needs no client
+	var fallback bytes.Buffer
+	hook := &CloudwatchHook{Fallback: &fallback, BreakerThreshold: 2, BreakerCooldown: time.Hour}
+	hook.breaker.record(false, 2)
+	hook.breaker.record(false, 2)
+	if got := hook.BreakerState(); got != BreakerOpen {
+		t.Fatalf("state after 2 failures = %v, want open", got)
+	}
+	if err := hook.sendEvent(events, ""); err != nil {
+		t.Fatalf("send while open: %v", err)
+	}
+	if got := fallback.String(); got != "[] one\n[] two\n" {
+		t.Errorf("fallback = %q", got)
+	}
+
+	// without a fallback the events are dropped
+	hook.Fallback = nil
+	if err := hook.sendEvent(events, ""); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("send while open without a fallback = %v, want ErrCircuitOpen", err)
+	}
+}
+
+func TestBreakerTransitions(t *testing.T) {
+	sink := &memSink{}
+	sink.fail(errors.New("unavailable"))
+	var fallback bytes.Buffer
+	hook := &CloudwatchHook{Sink: sink, Fallback: &fallback, BreakerThreshold: 2, BreakerCooldown: 50 * time.Millisecond}
+	if _, err := hook.GetHook(); err != nil {
+		t.Fatal(err)
+	}
+
+	write := func(msg string) error {
+		return hook.write(zapcore.Entry{Level: zapcore.InfoLevel, Message: msg})
+	}
+
+	if got := hook.BreakerState(); got != BreakerClosed {
+		t.Fatalf("initial state = %v, want closed", got)
+	}
+	for i := 0; i < 2; i++ {
+		if err := write("failing"); err == nil {
+			t.Fatal("put to a failing sink succeeded")
+		}
+	}
+	if got := hook.BreakerState(); got != BreakerOpen {
+		t.Fatalf("state after 2 failures = %v, want open", got)
+	}
+
+	// while open, events skip the sink and go to the fallback
+	sink.fail(nil)
+	fallback.Reset()
+	if err := write("short-circuited"); err != nil {
+		t.Fatalf("write while open: %v", err)
+	}
+	if sink.puts() != 0 {
+		t.Fatal("open breaker let a put through")
+	}
+	if got := fallback.String(); got != "[] short-circuited\n" {
+		t.Fatalf("fallback = %q", got)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if got := hook.BreakerState(); got != BreakerHalfOpen {
+		t.Fatalf("state after cooldown = %v, want half-open", got)
+	}
+
+	if err := write("probe"); err != nil {
+		t.Fatalf("probe: %v", err)
+	}
+	if got := hook.BreakerState(); got != BreakerClosed {
+		t.Fatalf("state after a successful probe = %v, want closed", got)
+	}
+	if msgs := sink.messages(); len(msgs) != 1 || msgs[0] != "[] probe" {
+		t.Fatalf("delivered %q, want the probe", msgs)
+	}
+}
+
+func TestBreakerFailedProbeReopens(t *testing.T) {
+	var b circuitBreaker
+	for i := 0; i < 3; i++ {
+		b.record(false, 3)
+	}
+	if b.allow(3, time.Hour) {
+		t.Fatal("open breaker allowed a put")
+	}
+
+	b.openedAt = time.Now().Add(-2 * time.Hour)
+	if !b.allow(3, time.Hour) {
+		t.Fatal("breaker past its cooldown allowed no probe")
+	}
+	if b.allow(3, time.Hour) {
+		t.Fatal("half-open breaker allowed a second probe")
+	}
+	b.record(false, 3)
+	if got := b.current(time.Hour); got != BreakerOpen {
+		t.Fatalf("state after a failed probe = %v, want open", got)
+	}
+}
+
+func TestBreakerDisabled(t *testing.T) {
+	var b circuitBreaker
+	for i := 0; i < 10; i++ {
+		b.record(false, 0)
+	}
+	if !b.allow(0, time.Hour) {
+		t.Fatal("disabled breaker blocked a put")
+	}
+}
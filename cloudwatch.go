@@ -2,13 +2,22 @@ package zapcloudwatch
 
 import (
 	"container/list"
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs/cloudwatchlogsiface"
 	"go.uber.org/zap/zapcore"
+	"hash"
+	"io"
+	"os"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -16,20 +25,378 @@ import (
 type CloudwatchHook struct {
 	// Messages with a log level not contained in this array
 	// will not be dispatched. If nil, all messages will be dispatched.
-	AcceptedLevels    []zapcore.Level
-	GroupName         string
-	StreamName        string
-	AWSConfig         *aws.Config
-	nextSequenceToken *string
-	svc               *cloudwatchlogs.CloudWatchLogs
-	Async             bool // if async is true, send a message asynchronously.
-	m                 sync.Mutex
+	AcceptedLevels []zapcore.Level
+	// LevelEnabler, if set, must also enable a level for it to be dispatched.
+	// A zap.AtomicLevel allows changing the level at runtime.
+	LevelEnabler zapcore.LevelEnabler
+	GroupName    string
+	StreamName   string
+	// GroupRouter, if set, picks the log group of each entry, e.g. to keep
+	// audit logs apart from application logs. An empty result means
+	// GroupName. Groups are created the first time an entry is routed there.
+	GroupRouter func(zapcore.Entry) string
+	// StreamContextKey, if set, is the context key of a stream name. Entries
+	// logged with a Context field whose context holds a non-empty string
+	// under it go to that stream of the group, e.g. one stream per request.
+	// Only cores made by GetCore see the fields to do so.
+	StreamContextKey interface{}
+	// StreamNameFunc, if set, picks the stream of each entry, e.g. from its
+	// logger name or date. An empty result means StreamName. A stream named
+	// in the entry's context wins.
+	StreamNameFunc func(zapcore.Entry) string
+	// StreamRules, if set, fan entries out: each goes to the stream of every
+	// rule matching it, e.g. warnings to "alerts" and everything to "all".
+	// Entries no rule matches go where they would without rules. A stream
+	// named in the entry's context wins.
+	StreamRules []StreamRule
+	// MaxRoutes, if positive, caps the streams other than StreamName kept
+	// open at once, with their buffers and tokens. The least recently used
+	// one is closed to make room.
+	MaxRoutes int
+	// MaxStreams, if positive, caps the streams other than StreamName and
+	// OverflowStream entries are ever routed to. Entries for further streams
+	// go to OverflowStream, or StreamName if that is empty, and each is
+	// reported as ErrTooManyStreams.
+	MaxStreams     int
+	OverflowStream string
+	// RouteIdleTimeout, if positive, closes routed streams that haven't been
+	// written to for this long. Idle streams are looked for whenever an entry
+	// is routed.
+	RouteIdleTimeout time.Duration
+	// ConfigureRoute, if set, adjusts the hook of each routed stream before
+	// its first write. Every routed stream already has a buffer and flush
+	// timer of its own; this can give them their own FlushInterval or
+	// BatchSize too, e.g. to flush quiet streams sooner. It may be called
+	// for a stream more than once when writes race to create its route; only
+	// one of the hooks is kept.
+	ConfigureRoute func(group, stream string, route *CloudwatchHook)
+	// AWSConfig configures the client built when Client is nil. Anything it
+	// leaves unset, everything if it is nil, comes from the SDK's default
+	// credential chain and region resolution, e.g. an instance role and
+	// AWS_REGION.
+	AWSConfig *aws.Config
+	// Credentials, if set, override the credentials in AWSConfig.
+	Credentials *credentials.Credentials
+	// CredentialsProvider, if set and Credentials is nil, is used to retrieve
+	// credentials, e.g. a stscreds.WebIdentityRoleProvider for IRSA.
+	CredentialsProvider credentials.Provider
+	// Client, if set, is used instead of a client built from AWSConfig.
+	Client cloudwatchlogsiface.CloudWatchLogsAPI
+	svc    cloudwatchlogsiface.CloudWatchLogsAPI
+	// Sink, if set, receives the formatted events instead of the log stream
+	// named above, and no log group or stream is set up.
+	Sink  Sink
+	Async bool // if async is true, send a message asynchronously.
+	// MaxInFlightBatches, if positive, caps the asynchronous puts under way
+	// at once. Writes block until one of them finishes.
+	MaxInFlightBatches int
+	// Fallback receives, one per line, the messages of events that could not
+	// be delivered to cloudwatch. If nil, those events are dropped.
+	Fallback io.Writer
+	// OnError, if set, is called with every failed put, including those made
+	// in the background, and with events cloudwatch rejected. Puts to
+	// cloudwatch fail with a *PutError carrying the AWS request id.
+	OnError func(error)
+	// DebugLogger, if set, is told what the hook does internally, such as
+	// batches put, retries and sequence token refreshes, e.g. log.Printf.
+	// It must not log through the hook itself.
+	DebugLogger func(format string, args ...interface{})
+	// ErrorInterval, if positive, limits OnError to one call per interval
+	// for each kind of error, so a long outage doesn't flood it. Errors are
+	// of a kind if they share an AWS error code or their innermost cause.
+	ErrorInterval time.Duration
+	// OnSuccess, if set, is called after every successful put with the number
+	// of events it delivered. By then their spool segment has been removed.
+	OnSuccess func(eventCount int)
+	// FallbackSink, if set, also receives undelivered events, e.g. an S3Sink
+	// archiving them for later replay.
+	FallbackSink Sink
+	// BreakerThreshold is the number of consecutive failed puts after which
+	// the circuit breaker opens. Zero disables the breaker.
+	BreakerThreshold int
+	// BreakerCooldown is how long the breaker stays open before a single
+	// probe is let through to check whether cloudwatch has recovered.
+	BreakerCooldown time.Duration
+	// MaxEventsPerSecond caps the rate at which events are put to cloudwatch.
+	// Events over the limit wait for their turn rather than failing. Routes
+	// count against the rate of the hook they were made from. Zero means
+	// unlimited.
+	MaxEventsPerSecond float64
+	// PutLimiter, if set, paces the hook's puts. Hooks sharing a limiter,
+	// such as SharedPutLimiter, stay under its rate together.
+	PutLimiter Limiter
+	// MessageTimeLayout, if set, is used to format the entry time and prepend
+	// it to the message text of FormatText entries, e.g. time.RFC3339Nano.
+	// This is independent of the event timestamp cloudwatch stores.
+	MessageTimeLayout string
+	// WarnZeroTime reports entries built without a time to OnError. They are
+	// given the current time either way.
+	WarnZeroTime bool
+	// Format selects how entries are serialized into event messages.
+	// Defaults to FormatText.
+	Format Format
+	// InvalidUTF8 selects what happens to invalid UTF-8 in event messages,
+	// which cloudwatch may reject or mangle. Defaults to sending them as is.
+	InvalidUTF8 UTF8Policy
+	// LoggerName selects whether FormatText entries carry their logger name
+	// as a message prefix, a field or both. Defaults to the prefix.
+	LoggerName LoggerNameFormat
+	// Serializer, if set, serializes entries instead of Format. Neither the
+	// logger name nor MessageTimeLayout is prefixed to what it returns.
+	Serializer Serializer
+	// FieldsKey, if set, nests all fields under this key in the JSON object,
+	// e.g. {"fields":{"level":"x"}}, so they can't collide with other keys.
+	FieldsKey string
+	// IndexedFields lists patterns of field keys kept at the top level of the
+	// object when FieldsKey is set, e.g. "request_id", so Logs Insights
+	// queries on them don't have to reach into the nested fields. Patterns
+	// use path.Match syntax.
+	IndexedFields []string
+	// FieldsSeparator goes between the message and its JSON fields, e.g. a
+	// tab or " ||| " to make splitting them reliable. Defaults to a space.
+	FieldsSeparator string
+	// ContextExtractors pull fields such as trace and span IDs out of the
+	// context attached to an entry with the Context field.
+	ContextExtractors []ContextExtractor
+	// ScopeID, if set, is called for every entry and its result added as the
+	// ScopeIDKey field, e.g. a goroutine or worker id to tell interleaved
+	// concurrent logs apart. A field of the same name, logged with the entry
+	// or added with With, wins.
+	ScopeID func() string
+	// ScopeIDKey is the key of the ScopeID field. Defaults to "scope_id".
+	ScopeIDKey string
+	// Metrics, if set, also publishes numeric fields of the entries sent as
+	// CloudWatch metrics.
+	Metrics *MetricsEmitter
+	// LargeIntsAsStrings encodes integers beyond 2^53, which lose precision
+	// when parsed as float64 by Logs Insights, as JSON strings.
+	LargeIntsAsStrings bool
+	// ResourceMetadata attaches the ECS task and container, or else the EC2
+	// instance, the process runs on to every event. It is looked up once
+	// during setup and left out if neither metadata endpoint answers.
+	ResourceMetadata bool
+	// ECSMetadataURI overrides the ECS_CONTAINER_METADATA_URI_V4 variable.
+	ECSMetadataURI string
+	// IMDSEndpoint overrides the EC2 instance metadata endpoint.
+	IMDSEndpoint string
+	// BatchIDs adds a "batch_id" field, a random UUID shared by the events
+	// of each put, to see which events were delivered together. It joins
+	// the object of FormatJSON events and is appended to others as a JSON
+	// object of its own, like the ContentHash fields.
+	BatchIDs bool
+	// EventIDs adds an "event_id" field to every entry, a hash of its time,
+	// level, logger, message and fields. Entries delivered twice, e.g. after
+	// a retried put, carry the same id so consumers can drop duplicates.
+	EventIDs bool
+	// ContentHash adds a "hash" field to every event, the hex SHA-256 of its
+	// message as it was before, for tamper evidence. Events are hashed as
+	// they are put, so the hash covers repeat counts; batch ids come after
+	// it.
+	ContentHash bool
+	// ContentHashFunc, if set, replaces SHA-256 for ContentHash.
+	ContentHashFunc func() hash.Hash
+	// HashChain makes the hash of each event also cover the hash of the
+	// event put before it to the stream, given as the "prev_hash" field, so
+	// events removed or reordered later break the chain. Puts are made one
+	// at a time while it is set, and the chain skips events that failed to
+	// be put.
+	HashChain bool
+	// SourceTag, if set, is added to every event as the "source" field, e.g.
+	// the service name, so logs of many services sharing a stream can be
+	// told apart with filter source="payments".
+	SourceTag string
+	// DuplicateKeys selects how fields sharing a key are encoded. Defaults to
+	// keeping the last one.
+	DuplicateKeys DuplicateKeyPolicy
+	// ReservedKeys selects what happens to fields named like those Logs
+	// Insights adds itself, such as @message. Defaults to keeping them.
+	ReservedKeys ReservedKeyPolicy
+	// BoolFormat selects how bool fields are encoded. Defaults to JSON bools.
+	BoolFormat BoolFormat
+	// DurationFormat selects how duration fields are encoded. Defaults to Go
+	// duration strings. Time fields are always RFC3339Nano strings.
+	DurationFormat DurationFormat
+	// ErrorDetails encodes error fields as objects holding the message, the
+	// messages of the wrapped causes and, for errors with a StackTrace method
+	// such as those of github.com/pkg/errors, the stack. Otherwise they are
+	// just the message.
+	ErrorDetails bool
+	// IncludeStacktrace adds the stack zap captured for an entry, see
+	// zap.AddStacktrace, as the stack field.
+	IncludeStacktrace bool
+	// StackFrames encodes stacks, of entries and of ErrorDetails, as arrays
+	// holding one "function file:line" string per frame rather than as a
+	// single multi-line string, so they read well in Logs Insights.
+	StackFrames bool
+	// DropFields lists, per level, patterns of field keys left out of that
+	// level's entries, e.g. {zapcore.DebugLevel: {"debug_*"}} to keep
+	// diagnostics local. Patterns use path.Match syntax.
+	DropFields map[zapcore.Level][]string
+	// FieldOrder lists keys to put first in JSON objects, in this order,
+	// e.g. "level", "msg". Other keys follow in sorted order. Only the top
+	// level of the object is ordered.
+	FieldOrder []string
+	// MarshalErrors selects what happens to entries with fields that can't
+	// be encoded. Defaults to failing the write.
+	MarshalErrors MarshalErrorPolicy
+	// MarshalFunc, if set, encodes fields instead of encoding/json, e.g.
+	// jsoniter.ConfigCompatibleWithStandardLibrary.Marshal. It must sort map
+	// keys for the output to stay stable.
+	MarshalFunc func(interface{}) ([]byte, error)
+	// MaxMessageLength, if positive, is the byte length messages are truncated
+	// to once formatted. Truncation respects UTF-8 boundaries and the result,
+	// including TruncationSuffix, never exceeds the limit. The limit includes
+	// the fields ContentHash and BatchIDs add and the CoalesceWindow repeat
+	// count, unless it is shorter than them.
+	MaxMessageLength int
+	// MaxFieldLength, if positive, is the byte length string field values
+	// are truncated to while encoding. It keeps a single huge field from
+	// bloating the event and is applied before MaxMessageLength.
+	MaxFieldLength int
+	// TruncationSuffix is appended to messages and field values cut short by
+	// MaxMessageLength or MaxFieldLength.
+	TruncationSuffix string
+	// BatchSize, if positive, buffers events and puts them once this many
+	// have accumulated.
+	BatchSize int
+	// FlushInterval, if positive, buffers events and puts whatever has
+	// accumulated at most this long after the first buffered event, so even
+	// a single entry is delivered without further writes.
+	FlushInterval time.Duration
+	// AlignFlushToClock puts buffered events at the next multiple of
+	// FlushInterval on the clock instead, e.g. at :00, :05 and :10 with 5s,
+	// so hooks across a fleet flush at the same moments.
+	AlignFlushToClock bool
+	// FlushOnLevel, if set, makes entries at the levels it enables skip
+	// buffering and Async: they are put right away together with everything
+	// buffered, e.g. zapcore.ErrorLevel for Error and above.
+	FlushOnLevel zapcore.LevelEnabler
+	// AdaptiveBatching buffers events into batches as large as a single put
+	// allows, 1 MB or 10,000 events, instead of a fixed BatchSize. Set a
+	// FlushInterval or MaxEventAge too, so quiet periods don't hold events.
+	// Whatever the batching, no put goes over those limits.
+	AdaptiveBatching bool
+	// FlushBytesThresholdPct, if between 1 and 99, puts the buffer once it
+	// holds this percentage of the 1 MB a put allows, e.g. 80, leaving room
+	// for a large event instead of splitting the batch before it.
+	FlushBytesThresholdPct int
+	// MaxEventAge, if positive, bounds how long a buffered event may wait:
+	// the buffer is put before its oldest event is older than this, however
+	// far it is from BatchSize or FlushInterval.
+	MaxEventAge time.Duration
+	// PackBatchAsSingleEvent puts each batch as one event whose message is a
+	// JSON array of {"timestamp","message"} objects, split only to respect
+	// the per event size limit. This cuts the event count, but Logs Insights
+	// then sees one record per batch: queries have to unnest the array and
+	// @timestamp is that of the first entry.
+	PackBatchAsSingleEvent bool
+	// CoalesceWindow, if positive, collapses identical consecutive messages
+	// of the same level logged within the window into a single event ending
+	// in "(repeated N times)", or carrying a "repeated" count with
+	// FormatJSON. Fields are part of the message, so entries only coalesce
+	// when their fields match too, unless CoalesceIgnoreFields is set.
+	CoalesceWindow time.Duration
+	// CoalesceIgnoreFields makes entries coalesce on their level, logger name
+	// and message alone, so a storm of errors differing only in a request id
+	// still collapses. The event sent carries the fields of the first entry.
+	CoalesceIgnoreFields bool
+	// SanitizeNames replaces characters cloudwatch doesn't allow in the group
+	// and stream names with NameReplacement, reporting each rename through
+	// OnError. Off by default so names are never changed by surprise.
+	SanitizeNames bool
+	// NameReplacement replaces illegal name characters. Defaults to "_".
+	NameReplacement string
+	// SpoolDir, if set, is a directory every event is written to before it
+	// is sent. Spooled events are removed once cloudwatch confirms them and
+	// whatever is left from a crashed process is replayed on setup.
+	SpoolDir string
+	// SpoolCodec, if set, compresses spool segments. Replay detects how each
+	// segment was written, so it can be changed between runs.
+	SpoolCodec Codec
+	// CloseTimeout, if positive, bounds how long Close waits for buffered
+	// events to be delivered. See CloseWithTimeout.
+	CloseTimeout time.Duration
+	// TokenStore, if set, persists the stream's sequence token so the next
+	// process can start putting without describing the stream first.
+	TokenStore TokenStore
+	// SetupRetries is how many times each describe or create call made while
+	// setting up is retried after a throttling or transient error.
+	SetupRetries int
+	// SetupRetryBackoff is the wait before the first setup retry. It doubles
+	// after every attempt. Defaults to 100ms.
+	SetupRetryBackoff time.Duration
+	// WhilePaused selects what happens to the batches a hook paused with
+	// Pause would put. Defaults to holding them until Resume.
+	WhilePaused PausePolicy
+	// MaxPausedEvents, if positive, bounds the events held while paused.
+	// Batches beyond it are dropped.
+	MaxPausedEvents int
+	// PutOnly skips describing and creating the log group and stream, for
+	// roles allowed nothing but logs:PutLogEvents. Both must exist already.
+	PutOnly bool
+	// WarmUp makes setup open the connection to cloudwatch with a describe
+	// call when it would otherwise make none, with PutOnly or a stored token,
+	// so the first put doesn't wait for DNS and the TLS handshake.
+	WarmUp bool
+	// VerifyPut makes Verify also check that puts are allowed, with a put to
+	// a stream that doesn't exist, so nothing is written.
+	VerifyPut bool
+	// ConfirmStreamTimeout, if positive, makes setup wait up to this long for
+	// a stream it created to be listed before the first put. A stream still
+	// missing by then is reported with ErrStreamNotVisible.
+	ConfirmStreamTimeout time.Duration
+	// SendTimeout, if positive, bounds every put, so a stuck network call
+	// can't hold up a background send forever. Timed out puts are reported
+	// to OnError and their events go to the fallback.
+	SendTimeout time.Duration
+	// MaxRetryDuration, if positive, has puts that fail with a throttling or
+	// transient error tried again, backing off, for up to this long after
+	// the first attempt. Events still undelivered then go to the fallback.
+	MaxRetryDuration time.Duration
+	// RequestOptions are applied to every PutLogEvents request, e.g. to add
+	// headers or instrumentation handlers.
+	RequestOptions []request.Option
+	sink           Sink
+	breaker        circuitBreaker
+	limiter        tokenBucket
+	errThrottle    errorThrottle
+	stats          hookStats
+	// record, if set, is handed every entry written, as TestHook does
+	record func(zapcore.Entry)
+	// sharedLimiter, if set, is the bucket of the hook a route was made
+	// from, which MaxEventsPerSecond counts against instead of limiter
+	sharedLimiter *tokenBucket
+	// inflight holds a slot for every asynchronous put under way
+	inflight   chan struct{}
+	pending    drain
+	bufMu      sync.Mutex
+	buf        []*cloudwatchlogs.InputLogEvent
+	bufBytes   int
+	flushTimer *time.Timer
+	dup        coalescer
+	spool      *spool
+	metadata   map[string]string
+	routes     router
+	chain      hashChain
+	pause      pauseState
+	acks       ackSet
+	closed     atomic.Bool
+	initMu     sync.Mutex
+	ready      atomic.Bool
 }
 
 type PikaCore struct {
 	zapcore.Core
+	// Hook, if set, supplies the options used to format fields.
+	Hook *CloudwatchHook
+
+	// fields are those added with With, sent along with every entry's own
+	fields []zapcore.Field
 }
 
+// defaultHook formats fields for a PikaCore without a hook
+var defaultHook CloudwatchHook
+
 type EntryQueue struct {
 	sync.Mutex
 	entries *list.List
@@ -39,58 +406,122 @@ func (eq *EntryQueue) Push(entry zapcore.Entry) {
 	eq.Lock()
 	defer eq.Unlock()
 
+	if eq.entries == nil {
+		eq.entries = list.New()
+	}
 	eq.entries.PushBack(entry)
 }
 
+// Pop removes and returns the oldest entry, or nil if the queue is empty.
+// Values of an unexpected type are discarded.
 func (eq *EntryQueue) Pop() *zapcore.Entry {
+	entry, _ := eq.pop()
+	return entry
+}
+
+// Len returns the number of queued entries
+func (eq *EntryQueue) Len() int {
+	eq.Lock()
+	defer eq.Unlock()
+
+	if eq.entries == nil {
+		return 0
+	}
+	return eq.entries.Len()
+}
+
+// Snapshot returns a copy of the queued entries, oldest first, without
+// removing them.
+func (eq *EntryQueue) Snapshot() []zapcore.Entry {
 	eq.Lock()
 	defer eq.Unlock()
 
-	if eq.entries.Len() == 0 {
+	if eq.entries == nil {
 		return nil
 	}
+	entries := make([]zapcore.Entry, 0, eq.entries.Len())
+	for e := eq.entries.Front(); e != nil; e = e.Next() {
+		if entry, ok := e.Value.(zapcore.Entry); ok {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+func (eq *EntryQueue) pop() (*zapcore.Entry, error) {
+	eq.Lock()
+	defer eq.Unlock()
+
+	if eq.entries == nil || eq.entries.Len() == 0 {
+		return nil, nil
+	}
 
 	e := eq.entries.Front()
 	eq.entries.Remove(e)
 
-	entry := e.Value.(zapcore.Entry)
+	entry, ok := e.Value.(zapcore.Entry)
+	if !ok {
+		return nil, fmt.Errorf("zapcloudwatch: unexpected %T in entry queue", e.Value)
+	}
 
-	return &entry
+	return &entry, nil
 }
 
+var errNilCore = errors.New("zapcloudwatch: PikaCore has no underlying core")
+
 var msgCache = EntryQueue{
 	entries: list.New(),
 }
 
+// With adds fields to the underlying core and keeps them to encode, with
+// their types, alongside the fields of every entry.
+func (c *PikaCore) With(fields []zapcore.Field) zapcore.Core {
+	if c.Core == nil {
+		return c
+	}
+	clone := *c
+	clone.Core = c.Core.With(fields)
+	clone.fields = make([]zapcore.Field, 0, len(c.fields)+len(fields))
+	clone.fields = append(clone.fields, c.fields...)
+	clone.fields = append(clone.fields, fields...)
+	return &clone
+}
+
 func (c *PikaCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
-	if c.Enabled(entry.Level) {
+	if c.Core != nil && c.Enabled(entry.Level) {
 		return checked.AddCore(entry, c)
 	}
 	return checked
 }
 
 func (c *PikaCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
-	// Original conversion of fields to a map.
-	fieldsMap := make(map[string]interface{})
-	for _, field := range fields {
-		switch field.Type {
-		case zapcore.StringType:
-			fieldsMap[field.Key] = field.String
-		case zapcore.Int64Type, zapcore.Int32Type, zapcore.Uint32Type, zapcore.Uint64Type:
-			fieldsMap[field.Key] = field.Integer
-		case zapcore.BoolType:
-			fieldsMap[field.Key] = field.Integer == 1
-		default:
-			fieldsMap[field.Key] = field.Interface
-		}
-	}
-
-	fieldsJson, err := json.Marshal(fieldsMap)
+	if c.Core == nil {
+		return errNilCore
+	}
+
+	hook := c.Hook
+	if hook == nil {
+		hook = &defaultHook
+	}
+	if hook.disabled() {
+		// nothing will be sent, so don't format or queue the entry
+		return c.Core.Write(entry, fields)
+	}
+
+	all := fields
+	if len(c.fields) > 0 {
+		all = make([]zapcore.Field, 0, len(c.fields)+len(fields))
+		all = append(all, c.fields...)
+		all = append(all, fields...)
+	}
+	msg, err := hook.serialize(entry, hook.dropFields(entry.Level, hook.withLogger(entry, hook.withStack(entry, hook.scoped(all)))))
 	if err != nil {
 		return err
 	}
-
-	entry.Message = fmt.Sprintf("%s %s", entry.Message, string(fieldsJson))
+	entry.Message = msg
+	if hook.WillSend(entry.Level) {
+		hook.Metrics.observe(entry, all)
+	}
 
 	msgCache.Push(entry)
 
@@ -111,90 +542,599 @@ func NewCloudwatchHook(groupName, streamName string, isAsync bool, cfg *aws.Conf
 
 // GetHook function returns hook to zap
 func (ch *CloudwatchHook) GetHook() (func(zapcore.Entry) error, error) {
+	return ch.GetHookWithContext(context.Background())
+}
+
+// GetHookWithContext is like GetHook but gives up on setting up the log group
+// and stream once ctx is done.
+func (ch *CloudwatchHook) GetHookWithContext(ctx context.Context) (func(zapcore.Entry) error, error) {
 
 	var cloudwatchWriter = func(e zapcore.Entry) error {
-		if !ch.isAcceptedLevel(e.Level) {
-			return nil
+		// pop before the level check so a rejected entry doesn't leave its
+		// modified copy behind to be paired with the next one.
+		modifiedEntry, err := msgCache.pop()
+		if err != nil {
+			return err
 		}
-
-		modifiedEntry := msgCache.Pop()
 		if modifiedEntry != nil {
-			e = *modifiedEntry
+			return ch.send(*modifiedEntry, "", delivery{dupKey: ch.dupKey(e)})
 		}
+		return ch.writeEntry(e)
+	}
+
+	if err := ch.init(ctx); err != nil {
+		return nil, err
+	}
+	return cloudwatchWriter, nil
+}
+
+// write dispatches an entry whose message is already formatted. Text
+// messages are prefixed with the entry's logger name, which zap composes
+// from nested Named calls, e.g. [parent.sub], unless LoggerName is
+// LoggerNameField.
+func (ch *CloudwatchHook) write(e zapcore.Entry) error {
+	return ch.writeTo(e, "")
+}
+
+// writeEntry writes an entry that didn't go through a core, serializing its
+// message first. Text messages are kept as they are if the hook adds no
+// fields of its own, such as SourceTag or resource metadata.
+func (ch *CloudwatchHook) writeEntry(e zapcore.Entry) error {
+	return ch.writeEntryAck(e, nil)
+}
 
-		event := &cloudwatchlogs.InputLogEvent{
-			Message:   aws.String(fmt.Sprintf("[%s] %s", e.LoggerName, e.Message)),
-			Timestamp: aws.Int64(int64(time.Nanosecond) * time.Now().UnixNano() / int64(time.Millisecond)),
+// writeEntryAck is writeEntry telling ack, if not nil, the outcome of the
+// entry's put
+func (ch *CloudwatchHook) writeEntryAck(e zapcore.Entry, ack *entryAck) error {
+	ch.stamp(&e)
+	d := delivery{ack: ack, dupKey: ch.dupKey(e)}
+	if ch.WillSend(e.Level) {
+		// the metadata is looked up by setup
+		if err := ch.init(context.Background()); err != nil {
+			return err
 		}
-		params := &cloudwatchlogs.PutLogEventsInput{
-			LogEvents:     []*cloudwatchlogs.InputLogEvent{event},
-			LogGroupName:  aws.String(ch.GroupName),
-			LogStreamName: aws.String(ch.StreamName),
-			SequenceToken: ch.nextSequenceToken,
+		fields := ch.withLogger(e, ch.withStack(e, ch.scoped(nil)))
+		if !ch.textual() || len(fields) > 0 || len(ch.resourceMetadata()) > 0 || ch.EventIDs {
+			msg, err := ch.serialize(e, fields)
+			if err != nil {
+				return err
+			}
+			e.Message = msg
 		}
+	}
+	return ch.send(e, "", d)
+}
 
-		if ch.Async {
-			go ch.sendEvent(params)
-			return nil
+// ErrZeroTime is reported when WarnZeroTime is set and an entry has no time.
+var ErrZeroTime = errors.New("zapcloudwatch: entry has no time, using the current time")
+
+// stamp gives an entry built without a time, as code constructing entries
+// by hand may, the current time
+func (ch *CloudwatchHook) stamp(e *zapcore.Entry) {
+	if !e.Time.IsZero() {
+		return
+	}
+	e.Time = time.Now()
+	if ch.WarnZeroTime {
+		ch.reportError(ErrZeroTime)
+	}
+}
+
+// writeTo is write with a stream overriding the hook's own, unless empty
+func (ch *CloudwatchHook) writeTo(e zapcore.Entry, stream string) error {
+	return ch.send(e, stream, delivery{})
+}
+
+// delivery is what an entry carries along on its way to a stream
+type delivery struct {
+	// ack, if set, is told the outcome of the entry's put
+	ack *entryAck
+	// dupKey, if set, identifies the entry for CoalesceWindow instead of its
+	// formatted message
+	dupKey string
+}
+
+// send is writeTo with the entry's delivery
+func (ch *CloudwatchHook) send(e zapcore.Entry, stream string, d delivery) error {
+	if ch.closed.Load() {
+		return ErrClosed
+	}
+	if !ch.WillSend(e.Level) {
+		if d.ack != nil {
+			return ErrNotSent
 		}
+		return nil
+	}
+	ch.stamp(&e)
+	if err := ch.init(context.Background()); err != nil {
+		return err
+	}
+	if ch.record != nil {
+		ch.record(e)
+	}
+	if len(ch.StreamRules) > 0 && stream == "" {
+		if dests := ch.fanOut(e); len(dests) > 0 {
+			return ch.writeFanOut(dests, e, d)
+		}
+	}
+	if ch.routing() || stream != "" {
+		if dest := ch.admit(ch.destination(e, stream)); dest != (destination{ch.GroupName, ch.StreamName}) {
+			return ch.writeRoute(dest, e, d)
+		}
+	}
+	return ch.sendOwn(e, d)
+}
+
+// sendOwn formats an entry and buffers or delivers it to the hook's own
+// stream
+func (ch *CloudwatchHook) sendOwn(e zapcore.Entry, d delivery) error {
+	msg := e.Message
+	if ch.textual() {
+		if ch.LoggerName != LoggerNameField {
+			msg = fmt.Sprintf("[%s] %s", e.LoggerName, e.Message)
+		}
+		if ch.MessageTimeLayout != "" {
+			msg = e.Time.Format(ch.MessageTimeLayout) + " " + msg
+		}
+	}
+	msg = sanitizeUTF8(msg, ch.InvalidUTF8)
+	if ch.MaxMessageLength > 0 {
+		// the hash fields, batch ids and repeat counts are added once the
+		// message is sent, so they go in the room left
+		max := ch.MaxMessageLength - ch.appendRoom()
+		if max < 0 {
+			max = 0
+		}
+		msg = truncate(msg, max, ch.TruncationSuffix)
+	}
+	event := &cloudwatchlogs.InputLogEvent{
+		Message:   aws.String(msg),
+		Timestamp: aws.Int64(e.Time.UnixMilli()),
+	}
 
-		return ch.sendEvent(params)
+	if d.ack != nil {
+		ch.watchAck(event, d.ack)
+	}
+	if ch.CoalesceWindow > 0 {
+		// acknowledged events aren't merged into others
+		if !ch.urgent(e.Level) && d.ack == nil {
+			return ch.coalesce(e.Level, event, d.dupKey)
+		}
+		ch.flushCoalesced()
 	}
+	return ch.dispatch(e.Level, event)
+}
 
-	ch.svc = cloudwatchlogs.New(session.New(ch.AWSConfig))
+// urgent reports whether entries at level are delivered, along with
+// everything buffered, before write returns. zap exits or panics as soon as
+// a fatal or panic entry is written, so those always are, whatever Async
+// says.
+func (ch *CloudwatchHook) urgent(level zapcore.Level) bool {
+	return level >= zapcore.DPanicLevel || (ch.FlushOnLevel != nil && ch.FlushOnLevel.Enabled(level))
+}
 
-	lgresp, err := ch.svc.DescribeLogGroups(&cloudwatchlogs.DescribeLogGroupsInput{LogGroupNamePrefix: aws.String(ch.GroupName), Limit: aws.Int64(1)})
+// dispatch buffers or delivers a single event
+func (ch *CloudwatchHook) dispatch(level zapcore.Level, event *cloudwatchlogs.InputLogEvent) error {
+	ch.stats.enqueued.Add(1)
+	if ch.urgent(level) {
+		return ch.sendNow(event)
+	}
+	if ch.batching() {
+		return ch.enqueue(event)
+	}
+	events := []*cloudwatchlogs.InputLogEvent{event}
+	segment, err := ch.spool.writeSegment(events)
 	if err != nil {
-		return nil, err
+		ch.reportError(err)
+	}
+	return ch.deliver(events, segment)
+}
+
+// deliver sends the events, in the background if Async is set. segment is
+// the spool segment holding them, if any.
+func (ch *CloudwatchHook) deliver(events []*cloudwatchlogs.InputLogEvent, segment string) error {
+	if ch.Async {
+		if ch.inflight != nil {
+			ch.inflight <- struct{}{}
+		}
+		gen := ch.pending.start()
+		go func() {
+			defer ch.pending.done(gen)
+			ch.sendEvent(events, segment)
+			if ch.inflight != nil {
+				<-ch.inflight
+			}
+		}()
+		return nil
+	}
+
+	return ch.sendEvent(events, segment)
+}
+
+// init runs setup exactly once, however many goroutines race to call it.
+// Callers block until it is done. A failed setup is tried again next time.
+func (ch *CloudwatchHook) init(ctx context.Context) error {
+	if ch.ready.Load() {
+		return nil
+	}
+
+	ch.initMu.Lock()
+	defer ch.initMu.Unlock()
+
+	if ch.ready.Load() {
+		return nil
+	}
+	if err := ch.setup(ctx); err != nil {
+		return err
+	}
+	ch.ready.Store(true)
+	return nil
+}
+
+// setup builds the client and makes sure the log group and stream exist
+func (ch *CloudwatchHook) setup(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if ch.MaxInFlightBatches > 0 {
+		ch.inflight = make(chan struct{}, ch.MaxInFlightBatches)
+	}
+	ch.loadMetadata(ctx)
+	if ch.SourceTag != "" {
+		if ch.metadata == nil {
+			ch.metadata = make(map[string]string, 1)
+		}
+		ch.metadata[sourceKey] = ch.SourceTag
+	}
+
+	if ch.SpoolDir != "" {
+		ch.spool = &spool{dir: ch.SpoolDir, codec: ch.SpoolCodec}
+		if err := os.MkdirAll(ch.SpoolDir, 0o700); err != nil {
+			return err
+		}
+	}
+
+	if err := ch.Metrics.setup(ch.awsConfig(), ch.reportError, ch.Async); err != nil {
+		return err
+	}
+
+	if ch.Sink != nil {
+		ch.sink = ch.Sink
+		ch.replaySpool()
+		return nil
+	}
+
+	ch.sanitizeNames()
+
+	ch.svc = ch.Client
+	if ch.svc == nil {
+		svc, err := newClient(ch.awsConfig())
+		if err != nil {
+			return err
+		}
+		ch.svc = svc
+	}
+	sink := &cloudwatchSink{svc: ch.svc, group: ch.GroupName, stream: ch.StreamName, onError: ch.reportError, store: ch.TokenStore, opts: ch.RequestOptions, stats: &ch.stats, putOnly: ch.PutOnly, debugf: ch.debugf}
+	ch.sink = sink
+	if ch.PutOnly {
+		ch.warmUp(ctx)
+		ch.replaySpool()
+		return nil
+	}
+
+	// a persisted token saves describing the group and stream. If it turns out
+	// to be stale the sink picks up the right one on the first put.
+	if ch.TokenStore != nil {
+		token, err := ch.TokenStore.LoadToken(ch.GroupName, ch.StreamName)
+		if err != nil {
+			ch.reportError(err)
+		}
+		if token != nil {
+			sink.state(ch.StreamName).token = token
+			ch.warmUp(ctx)
+			ch.replaySpool()
+			return nil
+		}
+	}
+
+	var lgresp *cloudwatchlogs.DescribeLogGroupsOutput
+	err := ch.retrySetup(ctx, func() (err error) {
+		lgresp, err = ch.svc.DescribeLogGroupsWithContext(ctx, &cloudwatchlogs.DescribeLogGroupsInput{LogGroupNamePrefix: aws.String(ch.GroupName), Limit: aws.Int64(1)})
+		return err
+	})
+	if err != nil {
+		return err
 	}
 
 	if len(lgresp.LogGroups) < 1 {
 		// we need to create this log group
-		_, err := ch.svc.CreateLogGroup(&cloudwatchlogs.CreateLogGroupInput{LogGroupName: aws.String(ch.GroupName)})
-		if err != nil {
-			return nil, err
+		err := creates.do(ch.GroupName, func() error {
+			return ch.retrySetup(ctx, func() error {
+				_, err := ch.svc.CreateLogGroupWithContext(ctx, &cloudwatchlogs.CreateLogGroupInput{LogGroupName: aws.String(ch.GroupName)})
+				return err
+			})
+		})
+		// another process may have created it since
+		if err != nil && !isErrorCode(err, cloudwatchlogs.ErrCodeResourceAlreadyExistsException) {
+			return err
 		}
 	}
 
-	resp, err := ch.svc.DescribeLogStreams(&cloudwatchlogs.DescribeLogStreamsInput{
-		LogGroupName:        aws.String(ch.GroupName), // Required
-		LogStreamNamePrefix: aws.String(ch.StreamName),
+	var resp *cloudwatchlogs.DescribeLogStreamsOutput
+	err = ch.retrySetup(ctx, func() (err error) {
+		resp, err = ch.svc.DescribeLogStreamsWithContext(ctx, &cloudwatchlogs.DescribeLogStreamsInput{
+			LogGroupName:        aws.String(ch.GroupName), // Required
+			LogStreamNamePrefix: aws.String(ch.StreamName),
+		})
+		return err
 	})
+	if err != nil && isRetryable(err) {
+		// the token only saves a retry of the first put, which creates the
+		// stream or picks up the expected token itself
+		ch.debugf("zapcloudwatch: describing %s/%s failed, starting without a token: %v", ch.GroupName, ch.StreamName, err)
+		ch.replaySpool()
+		return nil
+	}
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	// grab the next sequence token
 	if len(resp.LogStreams) > 0 {
-		ch.nextSequenceToken = resp.LogStreams[0].UploadSequenceToken
-		return cloudwatchWriter, nil
+		sink.state(ch.StreamName).token = resp.LogStreams[0].UploadSequenceToken
+		ch.replaySpool()
+		return nil
 	}
 
 	// create stream if it doesn't exist. the next sequence token will be null
-	_, err = ch.svc.CreateLogStream(&cloudwatchlogs.CreateLogStreamInput{
-		LogGroupName:  aws.String(ch.GroupName),
-		LogStreamName: aws.String(ch.StreamName),
+	err = creates.do(ch.GroupName+"\x00"+ch.StreamName, func() error {
+		return ch.retrySetup(ctx, func() error {
+			_, err := ch.svc.CreateLogStreamWithContext(ctx, &cloudwatchlogs.CreateLogStreamInput{
+				LogGroupName:  aws.String(ch.GroupName),
+				LogStreamName: aws.String(ch.StreamName),
+			})
+			return err
+		})
 	})
+	if err != nil && !isErrorCode(err, cloudwatchlogs.ErrCodeResourceAlreadyExistsException) {
+		return err
+	}
+	if ch.ConfirmStreamTimeout > 0 {
+		if err := ch.waitForStream(ctx); err != nil {
+			ch.reportError(err)
+		}
+	}
+	ch.replaySpool()
+	return nil
+}
+
+// sendEvent puts the events. Their spool segment is removed once cloudwatch
+// has confirmed delivery; otherwise it stays behind to be replayed.
+func (ch *CloudwatchHook) sendEvent(events []*cloudwatchlogs.InputLogEvent, segment string) error {
+	if ch.hold(events, segment) {
+		return nil
+	}
+	if !ch.breaker.allow(ch.BreakerThreshold, ch.BreakerCooldown) {
+		ch.debugf("zapcloudwatch: circuit open, not putting %d events", len(events))
+		ch.acknowledge(events, ErrCircuitOpen)
+		if ch.Fallback == nil && ch.FallbackSink == nil {
+			ch.stats.dropped.Add(int64(len(events)))
+			return ErrCircuitOpen
+		}
+		return ch.writeFallback(events)
+	}
 
+	ch.eventLimiter().wait(len(events), ch.MaxEventsPerSecond)
+	if ch.PutLimiter != nil {
+		ch.PutLimiter.Wait(1)
+	}
+
+	// hashing and tagging copy the events, those waiting on them are told
+	// by the originals
+	sent := events
+	var err error
+	if ch.ContentHash {
+		events, err = ch.putHashed(events)
+	} else {
+		events, err = ch.putTagged(events)
+	}
+	ch.breaker.record(err == nil, ch.BreakerThreshold)
+	ch.acknowledge(sent, err)
 	if err != nil {
-		return nil, err
+		ch.debugf("zapcloudwatch: put of %d events failed: %v", len(events), err)
+		ch.stats.failed.Add(int64(len(events)))
+		ch.reportError(err)
+		ch.writeFallback(events)
+		return err
 	}
-	return cloudwatchWriter, nil
+	ch.debugf("zapcloudwatch: put %d events to %s/%s", len(events), ch.GroupName, ch.StreamName)
+	ch.stats.delivered(events)
+	ch.spool.remove(segment)
+	if ch.OnSuccess != nil {
+		ch.OnSuccess(len(events))
+	}
+	return nil
+}
+
+// putTagged adds the batch id to events, if BatchIDs is set, and puts them,
+// packed into one with PackBatchAsSingleEvent, returning them
+func (ch *CloudwatchHook) putTagged(events []*cloudwatchlogs.InputLogEvent) ([]*cloudwatchlogs.InputLogEvent, error) {
+	if ch.BatchIDs {
+		events = ch.tagBatch(events)
+	}
+	put := events
+	if ch.PackBatchAsSingleEvent {
+		put = pack(events)
+	}
+	return events, ch.putRetrying(put)
 }
 
-func (ch *CloudwatchHook) sendEvent(params *cloudwatchlogs.PutLogEventsInput) error {
+// put hands events to the sink, giving up after SendTimeout if one is set.
+// A sink that isn't a ContextSink is left to finish in the background.
+func (ch *CloudwatchHook) put(events []*cloudwatchlogs.InputLogEvent) error {
+	if ch.SendTimeout <= 0 {
+		return ch.sink.Put(events)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), ch.SendTimeout)
+	defer cancel()
+	if cs, ok := ch.sink.(ContextSink); ok {
+		return cs.PutWithContext(ctx, events)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- ch.sink.Put(events)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("zapcloudwatch: put abandoned: %w", ctx.Err())
+	}
+}
 
-	ch.m.Lock()
-	defer ch.m.Unlock()
+// ErrOwnClient is returned by SetAWSConfig for hooks given a Client or Sink,
+// which have no client of their own to rebuild.
+var ErrOwnClient = errors.New("zapcloudwatch: hook has a Client or Sink, not a client of its own")
 
-	resp, err := ch.svc.PutLogEvents(params)
+// SetAWSConfig replaces AWSConfig and rebuilds the client, e.g. after static
+// credentials were rotated. Buffered events and sequence tokens are kept and
+// go out through the new client.
+func (ch *CloudwatchHook) SetAWSConfig(cfg *aws.Config) error {
+	// routed streams copy the config and share the client
+	ch.routes.mu.Lock()
+	defer ch.routes.mu.Unlock()
+
+	ch.initMu.Lock()
+	if ch.Client != nil || ch.Sink != nil {
+		ch.initMu.Unlock()
+		return ErrOwnClient
+	}
+	prev := ch.AWSConfig
+	ch.AWSConfig = cfg
+	if !ch.ready.Load() {
+		// setup builds the client from the new config
+		ch.initMu.Unlock()
+		return nil
+	}
+	svc, err := newClient(ch.awsConfig())
 	if err != nil {
+		ch.AWSConfig = prev
+		ch.initMu.Unlock()
 		return err
 	}
-	ch.nextSequenceToken = resp.NextSequenceToken
+	ch.initMu.Unlock()
+
+	ch.useClient(svc)
+	for el := ch.routes.lru.Front(); el != nil; el = el.Next() {
+		r := el.Value.(*route)
+		r.hook.AWSConfig = cfg
+		r.hook.useClient(svc)
+	}
 	return nil
 }
 
+// useClient switches a set up hook over to svc
+func (ch *CloudwatchHook) useClient(svc cloudwatchlogsiface.CloudWatchLogsAPI) {
+	ch.initMu.Lock()
+	defer ch.initMu.Unlock()
+
+	if ch.Client != nil {
+		ch.Client = svc
+	}
+	ch.svc = svc
+	if sink, ok := ch.sink.(*cloudwatchSink); ok {
+		sink.setClient(svc)
+	}
+}
+
+// newClient builds a cloudwatch client from cfg. Whatever cfg leaves unset,
+// all of it if cfg is nil, comes from the SDK's defaults: credentials from
+// the environment, the shared files or the instance or task role, and the
+// region from AWS_REGION or the shared config file.
+func newClient(cfg *aws.Config) (*cloudwatchlogs.CloudWatchLogs, error) {
+	sess, err := newSession(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return cloudwatchlogs.New(sess), nil
+}
+
+// newSession builds a session from cfg and the SDK's defaults, as newClient
+// describes
+func newSession(cfg *aws.Config) (*session.Session, error) {
+	opts := session.Options{SharedConfigState: session.SharedConfigEnable}
+	if cfg != nil {
+		opts.Config = *cfg
+	}
+	sess, err := session.NewSessionWithOptions(opts)
+	if err != nil {
+		return nil, fmt.Errorf("zapcloudwatch: creating AWS session: %w", err)
+	}
+	return sess, nil
+}
+
+// awsConfig returns AWSConfig with the configured credentials applied
+func (ch *CloudwatchHook) awsConfig() *aws.Config {
+	creds := ch.Credentials
+	if creds == nil && ch.CredentialsProvider != nil {
+		creds = credentials.NewCredentials(ch.CredentialsProvider)
+	}
+	if creds == nil {
+		return ch.AWSConfig
+	}
+
+	cfg := aws.NewConfig()
+	if ch.AWSConfig != nil {
+		cfg = ch.AWSConfig.Copy()
+	}
+	return cfg.WithCredentials(creds)
+}
+
+// writeFallback hands undelivered events to the fallback writer and sink
+func (ch *CloudwatchHook) writeFallback(events []*cloudwatchlogs.InputLogEvent) error {
+	if ch.Fallback == nil && ch.FallbackSink == nil {
+		ch.stats.dropped.Add(int64(len(events)))
+		return nil
+	}
+
+	var err error
+	if ch.Fallback != nil {
+		for _, event := range events {
+			if _, err = fmt.Fprintln(ch.Fallback, aws.StringValue(event.Message)); err != nil {
+				break
+			}
+		}
+	}
+	if ch.FallbackSink != nil {
+		if sinkErr := ch.FallbackSink.Put(events); sinkErr != nil {
+			err = sinkErr
+		}
+	}
+	return err
+}
+
+// debugf passes a diagnostic to DebugLogger, if set
+func (ch *CloudwatchHook) debugf(format string, args ...interface{}) {
+	if ch.DebugLogger != nil {
+		ch.DebugLogger(format, args...)
+	}
+}
+
+// reportError passes err to OnError, if set
+func (ch *CloudwatchHook) reportError(err error) {
+	if ch.OnError != nil && ch.errThrottle.allow(err, ch.ErrorInterval) {
+		ch.OnError(err)
+	}
+}
+
+// BreakerState returns the current state of the circuit breaker
+func (ch *CloudwatchHook) BreakerState() BreakerState {
+	return ch.breaker.current(ch.BreakerCooldown)
+}
+
 // Levels sets which levels to sent to cloudwatch
 func (ch *CloudwatchHook) Levels() []zapcore.Level {
 	if ch.AcceptedLevels == nil {
@@ -203,8 +1143,45 @@ func (ch *CloudwatchHook) Levels() []zapcore.Level {
 	return ch.AcceptedLevels
 }
 
+// disabled reports whether AcceptedLevels was set to an empty slice, which
+// turns the hook off.
+func (ch *CloudwatchHook) disabled() bool {
+	return ch.AcceptedLevels != nil && len(ch.AcceptedLevels) == 0
+}
+
+// WillSend reports whether an entry at level would be sent to cloudwatch,
+// so callers can skip building expensive messages that would be dropped.
+func (ch *CloudwatchHook) WillSend(level zapcore.Level) bool {
+	if ch.closed.Load() || !ch.isAcceptedLevel(level) {
+		return false
+	}
+	return ch.LevelEnabler == nil || ch.LevelEnabler.Enabled(level)
+}
+
+// isAcceptedLevel reports whether level is one of Levels. Custom levels
+// outside AllLevels are accepted if they are at least the lowest accepted level.
 func (ch *CloudwatchHook) isAcceptedLevel(level zapcore.Level) bool {
-	for _, lv := range ch.Levels() {
+	levels := ch.Levels()
+	for _, lv := range levels {
+		if lv == level {
+			return true
+		}
+	}
+	if isStandardLevel(level) || len(levels) == 0 {
+		return false
+	}
+
+	lowest := levels[0]
+	for _, lv := range levels {
+		if lv < lowest {
+			lowest = lv
+		}
+	}
+	return level >= lowest
+}
+
+func isStandardLevel(level zapcore.Level) bool {
+	for _, lv := range AllLevels {
 		if lv == level {
 			return true
 		}
@@ -222,12 +1199,40 @@ var AllLevels = []zapcore.Level{
 	zapcore.PanicLevel,
 }
 
+// ParseLevels parses a comma separated list of level names, such as
+// "info,error,fatal", for AcceptedLevels. A blank string gives nil, which
+// AcceptedLevels takes as every level.
+func ParseLevels(s string) ([]zapcore.Level, error) {
+	var levels []zapcore.Level
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		var level zapcore.Level
+		if err := level.UnmarshalText([]byte(name)); err != nil {
+			return nil, fmt.Errorf("zapcloudwatch: %w", err)
+		}
+		levels = append(levels, level)
+	}
+	return levels, nil
+}
+
 // LevelThreshold - Returns every logging level above and including the given parameter.
+// For a custom level outside AllLevels it returns the standard levels numerically
+// greater than it, plus the level itself.
 func LevelThreshold(l zapcore.Level) []zapcore.Level {
 	for i := range AllLevels {
 		if AllLevels[i] == l {
 			return AllLevels[i:]
 		}
 	}
-	return []zapcore.Level{}
+
+	levels := []zapcore.Level{l}
+	for _, lv := range AllLevels {
+		if lv > l {
+			levels = append(levels, lv)
+		}
+	}
+	return levels
 }
@@ -0,0 +1,748 @@
+package zapcloudwatch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestEntryQueueEmpty(t *testing.T) {
+	var zero EntryQueue
+	if e := zero.Pop(); e != nil {
+		t.Fatalf("zero queue popped %v", e)
+	}
+	if n := zero.Len(); n != 0 {
+		t.Fatalf("zero queue has %d entries", n)
+	}
+
+	var q EntryQueue
+	q.Push(zapcore.Entry{Message: "only"})
+	if e := q.Pop(); e == nil || e.Message != "only" {
+		t.Fatalf("popped %v, want the pushed entry", e)
+	}
+	if e, err := q.pop(); e != nil || err != nil {
+		t.Fatalf("drained queue popped %v, %v", e, err)
+	}
+}
+
+func TestEntryQueueLenSnapshot(t *testing.T) {
+	var q EntryQueue
+	if got := q.Snapshot(); got != nil {
+		t.Fatalf("zero queue snapshot = %v", got)
+	}
+	for _, msg := range []string{"a", "b", "c"} {
+		q.Push(zapcore.Entry{Message: msg})
+	}
+	if n := q.Len(); n != 3 {
+		t.Fatalf("Len = %d, want 3", n)
+	}
+
+	snap := q.Snapshot()
+	if len(snap) != 3 || snap[0].Message != "a" || snap[2].Message != "c" {
+		t.Fatalf("snapshot = %v, want the entries oldest first", snap)
+	}
+	snap[0].Message = "changed"
+	if n := q.Len(); n != 3 {
+		t.Fatalf("Len after Snapshot = %d, want nothing removed", n)
+	}
+	if e := q.Pop(); e == nil || e.Message != "a" {
+		t.Fatalf("popped %v, want the snapshot to be a copy", e)
+	}
+	if n, snap := q.Len(), q.Snapshot(); n != 2 || len(snap) != 2 {
+		t.Fatalf("after a pop Len = %d and snapshot = %v", n, snap)
+	}
+}
+
+func TestEntryQueueWrongType(t *testing.T) {
+	var q EntryQueue
+	q.Push(zapcore.Entry{Message: "first"})
+	q.entries.PushFront("not an entry")
+
+	if _, err := q.pop(); err == nil {
+		t.Fatal("popping a string gave no error")
+	}
+	if e := q.Pop(); e == nil || e.Message != "first" {
+		t.Fatalf("popped %v after the bad value, want the entry behind it", e)
+	}
+}
+
+func TestPikaCoreNilFields(t *testing.T) {
+	obs, logs := observer.New(zapcore.DebugLevel)
+	core := &PikaCore{Core: obs, Hook: &CloudwatchHook{}}
+	defer msgCache.Pop()
+
+	if err := core.Write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "hi"}, nil); err != nil {
+		t.Fatalf("writing nil fields: %v", err)
+	}
+	if logs.Len() != 1 {
+		t.Fatalf("underlying core got %d entries, want 1", logs.Len())
+	}
+	queued := msgCache.Snapshot()
+	if len(queued) == 0 || queued[len(queued)-1].Message != "hi {}" {
+		t.Fatalf("queued %v, want the formatted entry", queued)
+	}
+}
+
+func TestPikaCoreWithoutCore(t *testing.T) {
+	var core PikaCore
+	if err := core.Write(zapcore.Entry{Message: "hi"}, nil); err != errNilCore {
+		t.Fatalf("got %v, want errNilCore", err)
+	}
+	if c := core.With(nil); c != &core {
+		t.Fatal("With on a core without an underlying core returned a new core")
+	}
+}
+
+func TestPikaCoreWithTyped(t *testing.T) {
+	obs, _ := observer.New(zapcore.DebugLevel)
+	core := &PikaCore{Core: obs, Hook: &CloudwatchHook{Format: FormatJSON}}
+	defer msgCache.Pop()
+
+	logger := zap.New(core).With(zap.Int("uid", 7), zap.Bool("admin", true))
+	logger.Info("hi", zap.Float64("score", 1.5))
+	queued := msgCache.Snapshot()
+	if len(queued) == 0 {
+		t.Fatal("nothing queued")
+	}
+	var obj map[string]interface{}
+	if err := json.Unmarshal([]byte(queued[len(queued)-1].Message), &obj); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{"uid": 7.0, "admin": true, "score": 1.5}
+	for k, v := range want {
+		if obj[k] != v {
+			t.Errorf("%s is %#v, want %#v", k, obj[k], v)
+		}
+	}
+}
+
+func TestGetHookEmptyQueue(t *testing.T) {
+	sink := &memSink{}
+	write, err := (&CloudwatchHook{Sink: sink}).GetHook()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for msgCache.Pop() != nil {
+	}
+
+	if err := write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "direct"}); err != nil {
+		t.Fatal(err)
+	}
+	if msgs := sink.messages(); len(msgs) != 1 || msgs[0] != "[] direct" {
+		t.Fatalf("delivered %q", msgs)
+	}
+}
+
+func TestMessageTimeLayout(t *testing.T) {
+	sink := &memSink{}
+	hook := &CloudwatchHook{Sink: sink, MessageTimeLayout: time.RFC3339Nano}
+	if _, err := hook.GetHook(); err != nil {
+		t.Fatal(err)
+	}
+	at := time.Date(2024, 3, 1, 12, 30, 0, 500, time.UTC)
+
+	if err := hook.write(zapcore.Entry{Level: zapcore.InfoLevel, Time: at, LoggerName: "api", Message: "ready"}); err != nil {
+		t.Fatal(err)
+	}
+	want := "2024-03-01T12:30:00.0000005Z [api] ready"
+	if msgs := sink.messages(); len(msgs) != 1 || msgs[0] != want {
+		t.Fatalf("delivered %q, want %q", msgs, want)
+	}
+}
+
+func TestGetHookWithCancelledContext(t *testing.T) {
+	m := &mockLogs{}
+	hook := &CloudwatchHook{GroupName: "group", StreamName: "stream", Client: m}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	start := time.Now()
+	write, err := hook.GetHookWithContext(ctx)
+	if !errors.Is(err, context.Canceled) || write != nil {
+		t.Fatalf("got %v, want context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Fatalf("returned after %v", elapsed)
+	}
+	if n := m.count("DescribeLogGroups"); n != 0 {
+		t.Fatalf("made %d describe calls with a cancelled context", n)
+	}
+
+	// a later call with a live context sets up as usual
+	if _, err := hook.GetHook(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGetHookWithContextDeadline(t *testing.T) {
+	// an endpoint that doesn't answer before the test is over
+	done := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer srv.Close()
+	defer close(done)
+	hook := &CloudwatchHook{GroupName: "group", StreamName: "stream", AWSConfig: &aws.Config{
+		Endpoint:    aws.String(srv.URL),
+		Region:      aws.String("us-east-1"),
+		Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+		MaxRetries:  aws.Int(0),
+	}}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := hook.GetHookWithContext(ctx); err == nil {
+		t.Fatal("setup against a hanging endpoint succeeded")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("returned after %v, past the 50ms deadline", elapsed)
+	}
+}
+
+// stubProvider hands out fixed credentials, counting the calls
+type stubProvider struct {
+	retrieved atomic.Int32
+}
+
+func (p *stubProvider) Retrieve() (credentials.Value, error) {
+	p.retrieved.Add(1)
+	return credentials.Value{AccessKeyID: "AKIDSTUB", SecretAccessKey: "secret", ProviderName: "stub"}, nil
+}
+
+func (p *stubProvider) IsExpired() bool {
+	return false
+}
+
+func TestDefaultCredentialChain(t *testing.T) {
+	// only the environment is there to resolve from
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(t.TempDir(), "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(t.TempDir(), "credentials"))
+	t.Setenv("AWS_REGION", "eu-west-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDENV")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+
+	hook := &CloudwatchHook{}
+	if cfg := hook.awsConfig(); cfg != nil {
+		t.Fatalf("a hook with no config gave %v, want nil for the defaults", cfg)
+	}
+	client, err := newClient(hook.awsConfig())
+	if err != nil {
+		t.Fatalf("building a client from a nil config: %v", err)
+	}
+	if region := aws.StringValue(client.Config.Region); region != "eu-west-1" {
+		t.Errorf("region %q, want the one from AWS_REGION", region)
+	}
+	creds, err := client.Config.Credentials.Get()
+	if err != nil || creds.AccessKeyID != "AKIDENV" {
+		t.Errorf("credentials %v, %v, want the ones from the environment", creds.AccessKeyID, err)
+	}
+}
+
+func TestCredentialsProvider(t *testing.T) {
+	var signedBy atomic.Value
+	srv := logsServer(t, func(r *http.Request) {
+		signedBy.Store(r.Header.Get("Authorization"))
+	})
+	provider := &stubProvider{}
+	hook := &CloudwatchHook{
+		GroupName:           "group",
+		StreamName:          "stream",
+		AWSConfig:           serverConfig(srv),
+		CredentialsProvider: provider,
+	}
+
+	if _, err := hook.GetHook(); err != nil {
+		t.Fatal(err)
+	}
+	if provider.retrieved.Load() == 0 {
+		t.Fatal("the provider was never asked for credentials")
+	}
+	if auth, _ := signedBy.Load().(string); !strings.Contains(auth, "Credential=AKIDSTUB/") {
+		t.Fatalf("requests were signed with %q, not the provider's key", auth)
+	}
+}
+
+func TestFatalSentSynchronously(t *testing.T) {
+	for _, level := range []zapcore.Level{zapcore.DPanicLevel, zapcore.PanicLevel, zapcore.FatalLevel} {
+		sink := &memSink{}
+		hook := &CloudwatchHook{Sink: sink, Async: true, BatchSize: 100, FlushInterval: time.Hour}
+		core, err := hook.GetCore(zapcore.DebugLevel)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := core.Write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "before"}, nil); err != nil {
+			t.Fatal(err)
+		}
+		if err := core.Write(zapcore.Entry{Level: level, Message: "crash"}, nil); err != nil {
+			t.Fatal(err)
+		}
+
+		// zap exits or panics right after Write returns, so nothing may be left
+		want := []string{"[] before {}", "[] crash {}"}
+		if got := sink.messages(); len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+			t.Errorf("%v: put %q before Write returned, want %q", level, got, want)
+		}
+	}
+}
+
+func TestUrgentFromBackgroundSend(t *testing.T) {
+	sink := &memSink{}
+	sink.fail(errors.New("unavailable"))
+	var hook *CloudwatchHook
+	var once sync.Once
+	reported := make(chan error, 1)
+	hook = &CloudwatchHook{Sink: sink, Async: true, OnError: func(error) {
+		// the failed put is still under way while its callback logs
+		once.Do(func() {
+			sink.fail(nil)
+			reported <- hook.write(zapcore.Entry{Level: zapcore.DPanicLevel, Message: "alert"})
+		})
+	}}
+	if _, err := hook.GetHook(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := hook.write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "lost"}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-reported:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("an urgent entry logged from a background send never returned")
+	}
+	if got := sink.messages(); fmt.Sprint(got) != "[[] alert]" {
+		t.Errorf("put %q, want the urgent entry", got)
+	}
+}
+
+func TestFlushOnLevel(t *testing.T) {
+	sink := &memSink{}
+	hook := &CloudwatchHook{Sink: sink, Async: true, BatchSize: 100, FlushInterval: time.Hour, FlushOnLevel: zapcore.ErrorLevel}
+	core, err := hook.GetCore(zapcore.DebugLevel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hook.Close()
+
+	for _, level := range []zapcore.Level{zapcore.InfoLevel, zapcore.WarnLevel} {
+		if err := core.Write(zapcore.Entry{Level: level, Message: level.String()}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := sink.messages(); len(got) != 0 {
+		t.Fatalf("put %q below FlushOnLevel, want them buffered", got)
+	}
+
+	if err := core.Write(zapcore.Entry{Level: zapcore.ErrorLevel, Message: "error"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"[] info {}", "[] warn {}", "[] error {}"}
+	if got := sink.messages(); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("put %q before Write returned, want %q", got, want)
+	}
+}
+
+func TestConcurrentFirstWrites(t *testing.T) {
+	m := &mockLogs{}
+	hook := &CloudwatchHook{GroupName: "group", StreamName: "stream", Client: m}
+	w := hook.NewWriter(zapcore.InfoLevel)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				if _, err := fmt.Fprintf(w, "writer %d line %d\n", i, j); err != nil {
+					t.Error(err)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	if err := hook.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, op := range []string{"DescribeLogGroups", "CreateLogGroup", "CreateLogStream"} {
+		if n := m.count(op); n != 1 {
+			t.Errorf("made %d %s calls, want setup to run once", n, op)
+		}
+	}
+	if got := m.messages("group", "stream"); len(got) != 80 {
+		t.Errorf("delivered %d events, want 80", len(got))
+	}
+}
+
+func TestLevelThreshold(t *testing.T) {
+	const trace = zapcore.Level(-2)
+	tests := []struct {
+		level zapcore.Level
+		want  []zapcore.Level
+	}{
+		{zapcore.WarnLevel, []zapcore.Level{zapcore.WarnLevel, zapcore.ErrorLevel, zapcore.FatalLevel, zapcore.PanicLevel}},
+		{zapcore.PanicLevel, []zapcore.Level{zapcore.PanicLevel}},
+		{trace, append([]zapcore.Level{trace}, AllLevels...)},
+		{zapcore.DPanicLevel, []zapcore.Level{zapcore.DPanicLevel, zapcore.FatalLevel, zapcore.PanicLevel}},
+	}
+	for _, tt := range tests {
+		got := LevelThreshold(tt.level)
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("LevelThreshold(%d) = %v, want %v", tt.level, got, tt.want)
+		}
+	}
+}
+
+func TestParseLevels(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []zapcore.Level
+		wantErr bool
+	}{
+		{"info,error,fatal", []zapcore.Level{zapcore.InfoLevel, zapcore.ErrorLevel, zapcore.FatalLevel}, false},
+		{" WARN , dpanic,", []zapcore.Level{zapcore.WarnLevel, zapcore.DPanicLevel}, false},
+		{"", nil, false},
+		{" , ", nil, false},
+		{"info,loud", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseLevels(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%q: got error %v, want one: %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if err != nil && !strings.HasPrefix(err.Error(), "zapcloudwatch: ") {
+			t.Errorf("%q: error %q lacks the package prefix", tt.in, err)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) || (got == nil) != (tt.want == nil) {
+			t.Errorf("%q: got %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestIsAcceptedLevelCustom(t *testing.T) {
+	const trace, critical = zapcore.Level(-2), zapcore.Level(7)
+	tests := []struct {
+		name     string
+		accepted []zapcore.Level
+		level    zapcore.Level
+		want     bool
+	}{
+		{"custom above threshold", LevelThreshold(zapcore.WarnLevel), critical, true},
+		{"dpanic above threshold", LevelThreshold(zapcore.WarnLevel), zapcore.DPanicLevel, true},
+		{"custom below threshold", LevelThreshold(zapcore.WarnLevel), trace, false},
+		{"standard below threshold", LevelThreshold(zapcore.WarnLevel), zapcore.InfoLevel, false},
+		{"custom threshold", LevelThreshold(trace), trace, true},
+		{"custom threshold passes debug", LevelThreshold(trace), zapcore.DebugLevel, true},
+		{"standard level not listed", []zapcore.Level{zapcore.ErrorLevel}, zapcore.FatalLevel, false},
+		{"custom above listed", []zapcore.Level{zapcore.ErrorLevel}, critical, true},
+		{"nil accepts all", nil, critical, true},
+		{"empty accepts none", []zapcore.Level{}, critical, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ch := &CloudwatchHook{AcceptedLevels: tt.accepted}
+			if got := ch.isAcceptedLevel(tt.level); got != tt.want {
+				t.Errorf("isAcceptedLevel(%d) = %v, want %v", tt.level, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCustomLevelSent(t *testing.T) {
+	const critical = zapcore.Level(7)
+	sink := &memSink{}
+	hook := &CloudwatchHook{Sink: sink, AcceptedLevels: LevelThreshold(zapcore.WarnLevel)}
+	core, err := hook.GetCore(zapcore.DebugLevel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ce := core.Check(zapcore.Entry{Level: critical, Message: "custom"}, nil); ce != nil {
+		ce.Write()
+	}
+	if ce := core.Check(zapcore.Entry{Level: zapcore.InfoLevel, Message: "below"}, nil); ce != nil {
+		ce.Write()
+	}
+	hook.Close()
+
+	if got := sink.messages(); len(got) != 1 || got[0] != "[] custom {}" {
+		t.Errorf("sent %q, want only the custom level entry", got)
+	}
+}
+
+func TestOnSuccess(t *testing.T) {
+	tests := []struct {
+		name string
+		pack bool
+		fail bool
+		want []int
+	}{
+		{"batches", false, false, []int{3, 3, 1}},
+		{"packed", true, false, []int{3, 3, 1}},
+		{"failed", false, true, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := &memSink{}
+			if tt.fail {
+				sink.fail(errors.New("unavailable"))
+			}
+			var counts []int
+			hook := &CloudwatchHook{
+				Sink:                   sink,
+				BatchSize:              3,
+				FlushInterval:          time.Hour,
+				PackBatchAsSingleEvent: tt.pack,
+				OnSuccess:              func(n int) { counts = append(counts, n) },
+				OnError:                func(error) {},
+			}
+			for i := 0; i < 7; i++ {
+				hook.AddMessage(zapcore.InfoLevel, fmt.Sprint("event ", i))
+			}
+			hook.Close()
+
+			if fmt.Sprint(counts) != fmt.Sprint(tt.want) {
+				t.Errorf("OnSuccess got %v, want %v", counts, tt.want)
+			}
+		})
+	}
+}
+
+func TestWillSend(t *testing.T) {
+	atom := zap.NewAtomicLevelAt(zapcore.InfoLevel)
+	hook := &CloudwatchHook{Sink: &memSink{}, AcceptedLevels: LevelThreshold(zapcore.DebugLevel), LevelEnabler: atom}
+
+	tests := []struct {
+		level zapcore.Level
+		want  bool
+	}{
+		{zapcore.DebugLevel, false},
+		{zapcore.InfoLevel, true},
+		{zapcore.ErrorLevel, true},
+	}
+	for _, tt := range tests {
+		if got := hook.WillSend(tt.level); got != tt.want {
+			t.Errorf("WillSend(%v) = %v, want %v", tt.level, got, tt.want)
+		}
+	}
+
+	atom.SetLevel(zapcore.DebugLevel)
+	if !hook.WillSend(zapcore.DebugLevel) {
+		t.Error("WillSend doesn't follow the LevelEnabler")
+	}
+	hook.AcceptedLevels = []zapcore.Level{zapcore.ErrorLevel}
+	if hook.WillSend(zapcore.InfoLevel) {
+		t.Error("WillSend ignores AcceptedLevels")
+	}
+	hook.Close()
+	if hook.WillSend(zapcore.ErrorLevel) {
+		t.Error("WillSend is true after Close")
+	}
+}
+
+// ctxHangSink is a ContextSink whose puts last until they are abandoned
+type ctxHangSink struct{}
+
+func (ctxHangSink) Put([]*cloudwatchlogs.InputLogEvent) error {
+	select {}
+}
+
+func (ctxHangSink) PutWithContext(ctx context.Context, _ []*cloudwatchlogs.InputLogEvent) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestSendTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	tests := []struct {
+		name string
+		sink Sink
+	}{
+		{"sink", hangSink{release: release}},
+		{"context sink", ctxHangSink{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var reported error
+			hook := &CloudwatchHook{Sink: tt.sink, SendTimeout: 20 * time.Millisecond, OnError: func(err error) { reported = err }}
+
+			start := time.Now()
+			err := hook.AddMessage(zapcore.InfoLevel, "stuck")
+			if took := time.Since(start); took > time.Second {
+				t.Fatalf("put took %v despite SendTimeout", took)
+			}
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Fatalf("got %v, want a deadline exceeded error", err)
+			}
+			if !errors.Is(reported, context.DeadlineExceeded) {
+				t.Errorf("OnError got %v", reported)
+			}
+		})
+	}
+}
+
+func TestSetAWSConfig(t *testing.T) {
+	var mu sync.Mutex
+	puts := make(map[string]int)
+	countPuts := func(name string) func(*http.Request) {
+		return func(r *http.Request) {
+			if strings.HasSuffix(r.Header.Get("X-Amz-Target"), "PutLogEvents") {
+				mu.Lock()
+				puts[name]++
+				mu.Unlock()
+			}
+		}
+	}
+	old, rotated := logsServer(t, countPuts("old")), logsServer(t, countPuts("rotated"))
+
+	hook := &CloudwatchHook{GroupName: "group", StreamName: "stream", AWSConfig: serverConfig(old), BatchSize: 10}
+	if _, err := hook.GetHook(); err != nil {
+		t.Fatal(err)
+	}
+	hook.AddMessage(zapcore.InfoLevel, "buffered before rotating")
+	if err := hook.SetAWSConfig(serverConfig(rotated)); err != nil {
+		t.Fatal(err)
+	}
+	hook.AddMessage(zapcore.InfoLevel, "after rotating")
+	if err := hook.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if puts["old"] != 0 || puts["rotated"] != 1 {
+		t.Errorf("puts went to %v, want the buffered batch put through the new client", puts)
+	}
+}
+
+func TestSetAWSConfigOwnClient(t *testing.T) {
+	hook := &CloudwatchHook{Client: &mockLogs{}}
+	if err := hook.SetAWSConfig(aws.NewConfig()); err != ErrOwnClient {
+		t.Errorf("got %v, want ErrOwnClient", err)
+	}
+}
+
+func TestPutOnly(t *testing.T) {
+	denied := func() error { return awserr.New("AccessDeniedException", "explicit deny", nil) }
+	m := &mockLogs{onDescribeGroups: denied, onDescribeStreams: denied, onCreateGroup: denied, onCreateStream: denied}
+	m.addStream("audit", "web")
+	hook := &CloudwatchHook{GroupName: "audit", StreamName: "web", Client: m, PutOnly: true}
+	core, err := hook.GetCore(zapcore.DebugLevel)
+	if err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	logger := zap.New(core)
+	logger.Info("one")
+	logger.Info("two")
+	if err := hook.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	checkMessages(t, m, "audit", "web", "[] one {}", "[] two {}")
+	for _, op := range []string{"DescribeLogGroups", "DescribeLogStreams", "CreateLogGroup", "CreateLogStream"} {
+		if n := m.count(op); n != 0 {
+			t.Errorf("made %d %s calls", n, op)
+		}
+	}
+	// with no describe to learn it from, the first put goes without a token
+	if puts := m.putInputs(); len(puts) == 0 || puts[0].SequenceToken != nil {
+		t.Errorf("first put %v, want one without a sequence token", puts)
+	}
+}
+
+func TestEventTimestamps(t *testing.T) {
+	m := &mockLogs{}
+	m.addStream("group", "stream")
+	var errs []error
+	hook := &CloudwatchHook{GroupName: "group", StreamName: "stream", Client: m, BatchSize: 3,
+		WarnZeroTime: true, OnError: func(err error) { errs = append(errs, err) }}
+	at := time.Now().Add(-time.Hour).Truncate(time.Millisecond)
+
+	before := time.Now()
+	// written out of order, as concurrent writers may
+	hook.AddEntry(zapcore.Entry{Time: at.Add(2 * time.Second), Level: zapcore.InfoLevel, Message: "second"})
+	hook.AddEntry(zapcore.Entry{Level: zapcore.InfoLevel, Message: "untimed"})
+	hook.AddEntry(zapcore.Entry{Time: at.Add(time.Second), Level: zapcore.InfoLevel, Message: "first"})
+	after := time.Now()
+	if err := hook.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	puts := m.putInputs()
+	if len(puts) != 1 || len(puts[0].LogEvents) != 3 {
+		t.Fatalf("got puts %v, want one of 3 events", puts)
+	}
+	events := puts[0].LogEvents
+	checkMessages(t, m, "group", "stream", "[] first", "[] second", "[] untimed")
+	if got := aws.Int64Value(events[0].Timestamp); got != at.Add(time.Second).UnixMilli() {
+		t.Errorf("first has timestamp %d, want its entry's time %d", got, at.Add(time.Second).UnixMilli())
+	}
+	if got := aws.Int64Value(events[1].Timestamp); got != at.Add(2*time.Second).UnixMilli() {
+		t.Errorf("second has timestamp %d, want its entry's time %d", got, at.Add(2*time.Second).UnixMilli())
+	}
+	if got := aws.Int64Value(events[2].Timestamp); got < before.UnixMilli() || got > after.UnixMilli() {
+		t.Errorf("untimed has timestamp %d, want the time it was written", got)
+	}
+	if len(errs) != 1 || errs[0] != ErrZeroTime {
+		t.Errorf("reported %v, want ErrZeroTime for untimed", errs)
+	}
+}
+
+func TestDebugLogger(t *testing.T) {
+	m := &mockLogs{checkTokens: true}
+	m.addStream("group", "stream")
+	var logged []string
+	hook := &CloudwatchHook{GroupName: "group", StreamName: "stream", Client: m, DebugLogger: func(format string, args ...interface{}) {
+		logged = append(logged, fmt.Sprintf(format, args...))
+	}}
+
+	hook.AddMessage(zapcore.InfoLevel, "a")
+	// another writer moved the stream's token on
+	m.mu.Lock()
+	m.streams["group/stream"] = "moved"
+	m.mu.Unlock()
+	hook.AddMessage(zapcore.InfoLevel, "b")
+	m.onPut = func(*cloudwatchlogs.PutLogEventsInput) error {
+		return awserr.New("AccessDeniedException", "not allowed", nil)
+	}
+	hook.AddMessage(zapcore.InfoLevel, "c")
+	hook.Close()
+
+	want := []string{
+		"zapcloudwatch: put 1 events to group/stream",
+		"zapcloudwatch: retrying put to group/stream with the expected sequence token",
+		"zapcloudwatch: put 1 events to group/stream",
+		"zapcloudwatch: put of 1 events failed: ",
+	}
+	if len(logged) != len(want) {
+		t.Fatalf("logged %q, want %q", logged, want)
+	}
+	for i, msg := range logged {
+		if !strings.HasPrefix(msg, want[i]) {
+			t.Errorf("message %d is %q, want %q", i, msg, want[i])
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package zapcloudwatch
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"go.uber.org/zap/zapcore"
+)
+
+// coalescer holds back the latest event while identical ones keep arriving
+type coalescer struct {
+	mu    sync.Mutex
+	event *cloudwatchlogs.InputLogEvent
+	level zapcore.Level
+	// key identifies the held event, see coalesce
+	key   string
+	count int
+	timer *time.Timer
+}
+
+// take returns the held event, its message marked with its repeat count by
+// repeated, and clears it. mu must be held.
+func (c *coalescer) take(repeated func(msg string, n int) string) (*cloudwatchlogs.InputLogEvent, zapcore.Level) {
+	event, level := c.event, c.level
+	if event != nil && c.count > 1 {
+		event.Message = aws.String(repeated(aws.StringValue(event.Message), c.count))
+	}
+	c.event = nil
+	c.key = ""
+	c.count = 0
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+	return event, level
+}
+
+// repeated marks a message as standing for n identical ones. A FormatJSON
+// message gets a "repeated" field, so it stays an object; others end in
+// "(repeated N times)".
+func (ch *CloudwatchHook) repeated(msg string, n int) string {
+	if ch.encodedObject(msg) {
+		return joinEncoded(msg, `"repeated":`+strconv.Itoa(n))
+	}
+	return fmt.Sprintf("%s (repeated %d times)", msg, n)
+}
+
+// dupKey returns what identifies an entry, its level aside, with
+// CoalesceIgnoreFields: its logger name and message before any fields were
+// added. Otherwise it is empty and events are told apart by their message.
+func (ch *CloudwatchHook) dupKey(e zapcore.Entry) string {
+	if ch.CoalesceWindow <= 0 || !ch.CoalesceIgnoreFields {
+		return ""
+	}
+	return e.LoggerName + "\x00" + e.Message
+}
+
+// coalesce counts event against the held one if they match, otherwise it
+// dispatches the held event and holds this one for CoalesceWindow. key, if
+// not empty, identifies event instead of its message.
+func (ch *CloudwatchHook) coalesce(level zapcore.Level, event *cloudwatchlogs.InputLogEvent, key string) error {
+	if key == "" {
+		key = aws.StringValue(event.Message)
+	}
+
+	c := &ch.dup
+	c.mu.Lock()
+	if c.event != nil && c.level == level && c.key == key {
+		c.count++
+		c.mu.Unlock()
+		return nil
+	}
+
+	prev, prevLevel := c.take(ch.repeated)
+	c.event, c.level, c.key, c.count = event, level, key, 1
+	c.timer = time.AfterFunc(ch.CoalesceWindow, func() {
+		defer ch.pending.done(ch.pending.start())
+		ch.flushCoalesced()
+	})
+	c.mu.Unlock()
+
+	if prev == nil {
+		return nil
+	}
+	return ch.dispatch(prevLevel, prev)
+}
+
+// flushCoalesced dispatches the held event, if any
+func (ch *CloudwatchHook) flushCoalesced() error {
+	ch.dup.mu.Lock()
+	event, level := ch.dup.take(ch.repeated)
+	ch.dup.mu.Unlock()
+
+	if event == nil {
+		return nil
+	}
+	return ch.dispatch(level, event)
+}
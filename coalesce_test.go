@@ -0,0 +1,99 @@
+package zapcloudwatch
+
+import (
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestCoalesce(t *testing.T) {
+	tests := []struct {
+		name         string
+		ignoreFields bool
+		format       Format
+		log          func(*zap.Logger)
+		want         []string
+	}{
+		{
+			name: "identical",
+			log: func(l *zap.Logger) {
+				for i := 0; i < 3; i++ {
+					l.Error("boom", zap.Int("code", 1))
+				}
+			},
+			want: []string{`[] boom {"code":1} (repeated 3 times)`},
+		},
+		{
+			name: "fields differ",
+			log: func(l *zap.Logger) {
+				l.Error("boom", zap.Int("req", 1))
+				l.Error("boom", zap.Int("req", 2))
+			},
+			want: []string{`[] boom {"req":1}`, `[] boom {"req":2}`},
+		},
+		{
+			name:         "fields ignored",
+			ignoreFields: true,
+			log: func(l *zap.Logger) {
+				l.Error("boom", zap.Int("req", 1))
+				l.Error("boom", zap.Int("req", 2))
+				l.Error("boom", zap.Int("req", 3))
+			},
+			want: []string{`[] boom {"req":1} (repeated 3 times)`},
+		},
+		{
+			name:         "levels differ",
+			ignoreFields: true,
+			log: func(l *zap.Logger) {
+				l.Warn("boom")
+				l.Error("boom")
+			},
+			want: []string{"[] boom {}", "[] boom {}"},
+		},
+		{
+			name:         "messages differ",
+			ignoreFields: true,
+			log: func(l *zap.Logger) {
+				l.Error("boom")
+				l.Error("bang")
+				l.Error("bang")
+			},
+			want: []string{"[] boom {}", "[] bang {} (repeated 2 times)"},
+		},
+		{
+			name:   "json",
+			format: FormatJSON,
+			log: func(l *zap.Logger) {
+				l.Error("boom")
+				l.Error("boom")
+			},
+			want: []string{`{"level":"error","msg":"boom","repeated":2}`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := &memSink{}
+			hook := &CloudwatchHook{Sink: sink, CoalesceWindow: time.Hour, CoalesceIgnoreFields: tt.ignoreFields, Format: tt.format}
+			core, err := hook.GetCore(zapcore.DebugLevel)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.log(zap.New(core))
+			if err := hook.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			got := sink.messages()
+			if len(got) != len(tt.want) {
+				t.Fatalf("sink got %q, want %q", got, tt.want)
+			}
+			for i := range tt.want {
+				if got[i] != tt.want[i] {
+					t.Errorf("event %d = %q, want %q", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
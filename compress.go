@@ -0,0 +1,69 @@
+package zapcloudwatch
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+)
+
+// Codec compresses spooled and archived batches. Streams must start with
+// Magic so a reader can tell which codec wrote them. Writers that need
+// flushing for partially written data to be readable should implement
+// Flush() error, as gzip and zstd writers do. A zstd codec can be plugged in
+// by wrapping github.com/klauspost/compress/zstd.
+type Codec interface {
+	// Magic is the header every compressed stream starts with.
+	Magic() []byte
+	NewWriter(w io.Writer) (io.WriteCloser, error)
+	NewReader(r io.Reader) (io.ReadCloser, error)
+}
+
+// GzipCodec compresses with gzip at Level. The zero value uses
+// gzip.DefaultCompression.
+type GzipCodec struct {
+	Level int
+}
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+func (c GzipCodec) Magic() []byte {
+	return gzipMagic
+}
+
+func (c GzipCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	level := c.Level
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+	return gzip.NewWriterLevel(w, level)
+}
+
+func (c GzipCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+// Decompress reads a spooled or archived batch, picking the codec matching
+// the start of r from the given codecs and gzip. Data no codec claims is
+// returned as is.
+func Decompress(r io.Reader, codecs ...Codec) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	for _, codec := range append(codecs, GzipCodec{}) {
+		if codec == nil {
+			continue
+		}
+		magic := codec.Magic()
+		if head, _ := br.Peek(len(magic)); len(magic) > 0 && bytes.Equal(head, magic) {
+			return codec.NewReader(br)
+		}
+	}
+	return io.NopCloser(br), nil
+}
+
+// flush flushes w if it buffers compressed data
+func flush(w io.Writer) error {
+	if f, ok := w.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+	return nil
+}
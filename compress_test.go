@@ -0,0 +1,146 @@
+package zapcloudwatch
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"testing"
+)
+
+// xorCodec is a stand-in for a third party codec: it flips every byte after
+// its magic.
+type xorCodec struct{}
+
+func (xorCodec) Magic() []byte {
+	return []byte("XOR1")
+}
+
+func (c xorCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	if _, err := w.Write(c.Magic()); err != nil {
+		return nil, err
+	}
+	return xorWriter{w}, nil
+}
+
+func (c xorCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	if _, err := io.ReadFull(r, make([]byte, len(c.Magic()))); err != nil {
+		return nil, err
+	}
+	return io.NopCloser(xorReader{r}), nil
+}
+
+type xorWriter struct{ w io.Writer }
+
+func (x xorWriter) Write(p []byte) (int, error) {
+	flipped := make([]byte, len(p))
+	for i, b := range p {
+		flipped[i] = ^b
+	}
+	return x.w.Write(flipped)
+}
+
+func (xorWriter) Close() error { return nil }
+
+type xorReader struct{ r io.Reader }
+
+func (x xorReader) Read(p []byte) (int, error) {
+	n, err := x.r.Read(p)
+	for i := range p[:n] {
+		p[i] = ^p[i]
+	}
+	return n, err
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	data := []byte(`{"timestamp":1,"message":"hello"}` + "\n")
+	tests := []struct {
+		name  string
+		codec Codec
+	}{
+		{"gzip", GzipCodec{}},
+		{"gzip best", GzipCodec{Level: gzip.BestCompression}},
+		{"custom", xorCodec{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w, err := tt.codec.NewWriter(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w.Write(data)
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.HasPrefix(buf.Bytes(), tt.codec.Magic()) {
+				t.Fatalf("stream starts with %x, want the magic %x", buf.Bytes()[:4], tt.codec.Magic())
+			}
+
+			r, err := Decompress(&buf, tt.codec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Errorf("got %q, want %q", got, data)
+			}
+		})
+	}
+}
+
+func TestDecompressDetects(t *testing.T) {
+	var gz bytes.Buffer
+	w, _ := GzipCodec{}.NewWriter(&gz)
+	w.Write([]byte("zipped"))
+	w.Close()
+
+	tests := []struct {
+		name   string
+		input  []byte
+		codecs []Codec
+		want   string
+	}{
+		{"plain", []byte("plain"), nil, "plain"},
+		{"gzip without codecs", gz.Bytes(), nil, "zipped"},
+		{"gzip with other codecs", gz.Bytes(), []Codec{xorCodec{}, nil}, "zipped"},
+		{"empty", nil, nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := Decompress(bytes.NewReader(tt.input), tt.codecs...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFlushMakesDataReadable(t *testing.T) {
+	var buf bytes.Buffer
+	w, _ := GzipCodec{}.NewWriter(&buf)
+	w.Write([]byte("partial"))
+	if err := flush(w); err != nil {
+		t.Fatal(err)
+	}
+
+	// without the trailer the data reads up to an unexpected EOF
+	r, err := Decompress(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := io.ReadAll(r)
+	if string(got) != "partial" {
+		t.Errorf("got %q before close, want the flushed data", got)
+	}
+}
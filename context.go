@@ -0,0 +1,77 @@
+package zapcloudwatch
+
+import (
+	"context"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// ContextExtractor returns a field to add for the given context, such as the
+// current trace ID. An empty key adds nothing.
+type ContextExtractor func(ctx context.Context) (key string, value string)
+
+const contextFieldKey = "zapcloudwatch.context"
+
+// Context returns a field carrying ctx so the hook's ContextExtractors can add
+// their fields to the entry:
+//
+//	logger.Info("charged card", zapcloudwatch.Context(ctx))
+//
+// Other cores skip the field, so it is safe to use with a tee.
+func Context(ctx context.Context) zapcore.Field {
+	return zapcore.Field{Key: contextFieldKey, Type: zapcore.SkipType, Interface: ctx}
+}
+
+// addContextFields runs the extractors on a field made by Context
+func (ch *CloudwatchHook) addContextFields(set *fieldSet, field zapcore.Field) {
+	ctx, ok := field.Interface.(context.Context)
+	if field.Key != contextFieldKey || !ok || ctx == nil {
+		return
+	}
+	for _, extract := range ch.ContextExtractors {
+		if key, value := extract(ctx); key != "" {
+			set.add(key, value)
+		}
+	}
+}
+
+// contextStream returns the stream named under StreamContextKey in the
+// context of the first field made by Context, or "" if there is none.
+func (ch *CloudwatchHook) contextStream(fields ...[]zapcore.Field) string {
+	if ch.StreamContextKey == nil {
+		return ""
+	}
+	for _, fs := range fields {
+		for _, field := range fs {
+			ctx, ok := field.Interface.(context.Context)
+			if field.Type != zapcore.SkipType || field.Key != contextFieldKey || !ok || ctx == nil {
+				continue
+			}
+			stream, _ := ctx.Value(ch.StreamContextKey).(string)
+			return stream
+		}
+	}
+	return ""
+}
+
+// defaultScopeIDKey is the key of the ScopeID field unless ScopeIDKey is set
+const defaultScopeIDKey = "scope_id"
+
+// scopeIDKey returns the key of the ScopeID field
+func (ch *CloudwatchHook) scopeIDKey() string {
+	if ch.ScopeIDKey == "" {
+		return defaultScopeIDKey
+	}
+	return ch.ScopeIDKey
+}
+
+// scoped returns fields preceded by the ScopeID field, if ScopeID is set, so
+// fields of the same key win
+func (ch *CloudwatchHook) scoped(fields []zapcore.Field) []zapcore.Field {
+	if ch.ScopeID == nil {
+		return fields
+	}
+	all := make([]zapcore.Field, 0, len(fields)+1)
+	all = append(all, zapcore.Field{Key: ch.scopeIDKey(), Type: zapcore.StringType, String: ch.ScopeID()})
+	return append(all, fields...)
+}
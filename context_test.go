@@ -0,0 +1,75 @@
+package zapcloudwatch
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+type traceKey struct{}
+
+func traceExtractor(ctx context.Context) (string, string) {
+	if id, ok := ctx.Value(traceKey{}).(string); ok {
+		return "trace_id", id
+	}
+	return "", ""
+}
+
+func TestContextExtractors(t *testing.T) {
+	sink := &memSink{}
+	hook := &CloudwatchHook{Sink: sink, ContextExtractors: []ContextExtractor{
+		traceExtractor,
+		func(context.Context) (string, string) { return "span_id", "b7ad6b7169203331" },
+	}}
+	core, err := hook.GetCore(zapcore.DebugLevel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := zap.New(core)
+
+	ctx := context.WithValue(context.Background(), traceKey{}, "0af7651916cd43dd8448eb211c80319c")
+	logger.Info("traced", Context(ctx), zap.Int("n", 1))
+	logger.Info("untraced", Context(context.Background()))
+	logger.Info("no context")
+
+	want := []string{
+		`[] traced {"n":1,"span_id":"b7ad6b7169203331","trace_id":"0af7651916cd43dd8448eb211c80319c"}`,
+		`[] untraced {"span_id":"b7ad6b7169203331"}`,
+		`[] no context {}`,
+	}
+	got := sink.messages()
+	if len(got) != len(want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("event %d = %s, want %s", i, got[i], want[i])
+		}
+	}
+}
+
+func TestScopeID(t *testing.T) {
+	sink := &memSink{}
+	hook := &CloudwatchHook{Sink: sink, ScopeID: func() string { return "worker-3" }}
+	core, err := hook.GetCore(zapcore.DebugLevel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := zap.New(core)
+
+	logger.Info("core")
+	// a field of the same key wins
+	logger.Info("own", zap.String("scope_id", "mine"))
+	// entries written without the core carry it too
+	hook.AddEntry(zapcore.Entry{Level: zapcore.InfoLevel, Message: "added"})
+	hook.AddMessage(zapcore.InfoLevel, "message")
+	hook.Close()
+
+	want := []string{`[] core {"scope_id":"worker-3"}`, `[] own {"scope_id":"mine"}`, `[] added {"scope_id":"worker-3"}`, `[] message {"scope_id":"worker-3"}`}
+	if got := sink.messages(); fmt.Sprintf("%q", got) != fmt.Sprintf("%q", want) {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+}
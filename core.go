@@ -0,0 +1,207 @@
+package zapcloudwatch
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// hookCore is a zapcore.Core that hands entries straight to a hook. Unlike
+// PikaCore it doesn't go through the package level queue, so it can be one
+// leaf of a zapcore.NewTee next to any other core.
+type hookCore struct {
+	zapcore.LevelEnabler
+	hook   *CloudwatchHook
+	fields []zapcore.Field
+
+	// encoded holds the values of the fields added with With, encoded once so
+	// only the fields of each call need encoding. It is nil if they failed
+	// to encode.
+	encoded map[string]json.RawMessage
+	// pairs holds the same values encoded along with their keys, ready to
+	// join into an object
+	pairs map[string][]byte
+	keys  map[string]struct{}
+}
+
+// GetCore sets up the log group and stream and returns a zap core that
+// sends entries, together with their fields, to cloudwatch.
+//
+//	cwCore, err := hook.GetCore(zapcore.InfoLevel)
+//	logger := zap.New(zapcore.NewTee(consoleCore, cwCore))
+func (ch *CloudwatchHook) GetCore(enab zapcore.LevelEnabler) (zapcore.Core, error) {
+	if err := ch.init(context.Background()); err != nil {
+		return nil, err
+	}
+	return &hookCore{LevelEnabler: enab, hook: ch}, nil
+}
+
+func (c *hookCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := *c
+	clone.fields = make([]zapcore.Field, 0, len(c.fields)+len(fields))
+	clone.fields = append(clone.fields, c.fields...)
+	clone.fields = append(clone.fields, fields...)
+
+	clone.keys = make(map[string]struct{}, len(clone.fields))
+	for _, field := range clone.fields {
+		// a renamed key is shadowed by call fields of either name
+		clone.keys[field.Key] = struct{}{}
+		if key, ok := reservedKey(field.Key, c.hook.ReservedKeys); ok {
+			clone.keys[key] = struct{}{}
+		}
+	}
+	if c.hook.disabled() {
+		// nothing will be sent, so don't bother encoding
+		return &clone
+	}
+	for k := range c.hook.resourceMetadata() {
+		clone.keys[k] = struct{}{}
+	}
+	clone.encoded, _ = c.hook.encodeValues(c.hook.fieldsWithMetadata(clone.fields))
+	clone.pairs = c.hook.encodePairs(clone.encoded)
+	return &clone
+}
+
+func (c *hookCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) && !c.hook.disabled() {
+		return checked.AddCore(entry, c)
+	}
+	return checked
+}
+
+func (c *hookCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	// event ids hash the time, so it is set before formatting
+	c.hook.stamp(&entry)
+	d := delivery{dupKey: c.hook.dupKey(entry)}
+	if _, ok := c.keys[c.hook.scopeIDKey()]; !ok {
+		fields = c.hook.scoped(fields)
+	}
+	fields = c.hook.withLogger(entry, c.hook.withStack(entry, fields))
+	msg, err := c.format(entry, fields)
+	if err != nil {
+		return err
+	}
+	entry.Message = msg
+	if c.hook.WillSend(entry.Level) {
+		c.hook.Metrics.observe(entry, c.fields, fields)
+	}
+
+	return c.hook.send(entry, c.hook.contextStream(fields, c.fields), d)
+}
+
+// format encodes the call fields and merges them with the cached contextual
+// fields, keeping the keys of the object sorted. When a call field shadows a
+// contextual one, everything is encoded again so the call field wins as it
+// would in a single map.
+func (c *hookCore) format(entry zapcore.Entry, fields []zapcore.Field) (string, error) {
+	level, msg := entry.Level, entry.Message
+	if len(c.fields) == 0 {
+		return c.hook.serialize(entry, c.hook.dropFields(level, fields))
+	}
+	if !c.hook.textual() || c.hook.EventIDs || len(c.hook.DropFields[level]) > 0 {
+		// the cached fields are only of use to the text format without ids,
+		// and may hold some that are dropped at this level
+		all := make([]zapcore.Field, 0, len(c.fields)+len(fields))
+		all = append(all, c.fields...)
+		all = append(all, fields...)
+		return c.hook.serialize(entry, c.hook.dropFields(level, all))
+	}
+
+	shadowed := c.encoded == nil
+	for _, field := range fields {
+		if _, ok := c.keys[field.Key]; ok {
+			shadowed = true
+			break
+		}
+	}
+	if shadowed {
+		all := make([]zapcore.Field, 0, len(c.fields)+len(fields))
+		all = append(all, c.fields...)
+		all = append(all, fields...)
+		return c.hook.serialize(entry, all)
+	}
+
+	if c.hook.FieldsKey == "" && len(c.hook.FieldOrder) == 0 {
+		// only the call fields need encoding; the cached values are joined in
+		// as they are
+		if call, err := c.hook.encodeValues(c.hook.fieldsMap(fields)); err == nil && c.pairs != nil {
+			if obj, ok := c.hook.joinObject(c.pairs, c.hook.encodePairs(call)); ok {
+				return c.hook.joinMessage(msg, obj)
+			}
+		}
+	}
+
+	// metadata is already part of the cached values. Marshaling the merged
+	// map keeps the keys sorted as if everything had been encoded at once.
+	merged := c.hook.fieldsMap(fields)
+	for k, v := range c.encoded {
+		merged[k] = v
+	}
+	obj, err := c.hook.marshalObject(c.hook.nest(merged), merged)
+	if err != nil {
+		return "", err
+	}
+	return c.hook.joinMessage(msg, obj)
+}
+
+func (c *hookCore) Sync() error {
+	return c.hook.Flush()
+}
+
+// encodePairs encodes the key of every value in front of it, as a member
+// of a JSON object. It returns nil if a key fails to encode.
+func (ch *CloudwatchHook) encodePairs(encoded map[string]json.RawMessage) map[string][]byte {
+	if encoded == nil {
+		return nil
+	}
+	pairs := make(map[string][]byte, len(encoded))
+	for k, v := range encoded {
+		key, err := ch.marshal(k)
+		if err != nil {
+			return nil
+		}
+		pair := make([]byte, 0, len(key)+1+len(v))
+		pair = append(pair, key...)
+		pair = append(pair, ':')
+		pairs[k] = append(pair, v...)
+	}
+	return pairs
+}
+
+// joinObject joins encoded members into a JSON object, keys sorted as
+// json.Marshal sorts them. Members in call win over those in cached. It
+// reports false if call failed to encode.
+func (ch *CloudwatchHook) joinObject(cached, call map[string][]byte) ([]byte, bool) {
+	if call == nil {
+		return nil, false
+	}
+	keys := make([]string, 0, len(cached)+len(call))
+	size := 2
+	for k, pair := range cached {
+		if _, ok := call[k]; !ok {
+			keys = append(keys, k)
+			size += len(pair) + 1
+		}
+	}
+	for k, pair := range call {
+		keys = append(keys, k)
+		size += len(pair) + 1
+	}
+	sort.Strings(keys)
+
+	buf := make([]byte, 0, size)
+	buf = append(buf, '{')
+	for i, k := range keys {
+		pair, ok := call[k]
+		if !ok {
+			pair = cached[k]
+		}
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		buf = append(buf, pair...)
+	}
+	return append(buf, '}'), true
+}
@@ -0,0 +1,241 @@
+package zapcloudwatch
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// contextFields are the fields of a request scoped logger
+var contextFields = []zapcore.Field{
+	zap.String("request_id", "3f2a9c"),
+	zap.String("user", "alice"),
+	zap.Int("tenant", 42),
+	zap.String("route", "/v1/payments"),
+	zap.Bool("canary", false),
+	zap.Duration("budget", 250*time.Millisecond),
+}
+
+func TestCachedFieldsMerge(t *testing.T) {
+	tests := []struct {
+		name string
+		with []zapcore.Field
+		call []zapcore.Field
+		want string
+	}{
+		{"call fields only", nil, []zapcore.Field{zap.Int("n", 1)}, `merge {"n":1}`},
+		{"interleaved keys", []zapcore.Field{zap.Int("a", 1), zap.String("c", "x")}, []zapcore.Field{zap.Int("b", 2), zap.Int("d", 4)}, `merge {"a":1,"b":2,"c":"x","d":4}`},
+		{"call field shadows", []zapcore.Field{zap.Int("a", 1), zap.Int("b", 2)}, []zapcore.Field{zap.Int("a", 5)}, `merge {"a":5,"b":2}`},
+		{"no call fields", []zapcore.Field{zap.String("a", "x")}, nil, `merge {"a":"x"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hook := &CloudwatchHook{Sink: &memSink{}}
+			core, err := hook.GetCore(zapcore.DebugLevel)
+			if err != nil {
+				t.Fatal(err)
+			}
+			core = core.With(tt.with)
+
+			entry := zapcore.Entry{Level: zapcore.InfoLevel, Message: "merge"}
+			got, err := core.(*hookCore).format(entry, tt.call)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+
+			// the cache must give what encoding everything at once does
+			all := append(append([]zapcore.Field(nil), tt.with...), tt.call...)
+			if uncached := serialized(t, hook, entry, all...); got != uncached {
+				t.Errorf("cached %s, uncached %s", got, uncached)
+			}
+		})
+	}
+}
+
+func TestCachedFieldsAcrossWith(t *testing.T) {
+	sink := &memSink{}
+	hook := &CloudwatchHook{Sink: sink}
+	core, err := hook.GetCore(zapcore.DebugLevel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parent := zap.New(core).With(zap.Int("a", 1))
+	child := parent.With(zap.Int("b", 2))
+
+	parent.Info("parent", zap.Int("c", 3))
+	child.Info("child", zap.Int("c", 3))
+
+	want := []string{`[] parent {"a":1,"c":3}`, `[] child {"a":1,"b":2,"c":3}`}
+	got := sink.messages()
+	if len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func BenchmarkWithFields(b *testing.B) {
+	hook := &CloudwatchHook{Sink: discardSink{}}
+	core, err := hook.GetCore(zapcore.DebugLevel)
+	if err != nil {
+		b.Fatal(err)
+	}
+	cached := core.With(contextFields).(*hookCore)
+	entry := zapcore.Entry{Level: zapcore.InfoLevel, Message: "charged"}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := cached.format(entry, []zapcore.Field{zap.Int("amount", i)}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkWithFieldsUncached encodes the same fields again for every
+// entry, as a core without the cache would
+func BenchmarkWithFieldsUncached(b *testing.B) {
+	hook := &CloudwatchHook{}
+	entry := zapcore.Entry{Level: zapcore.InfoLevel, Message: "charged"}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		fields := append(append(make([]zapcore.Field, 0, len(contextFields)+1), contextFields...), zap.Int("amount", i))
+		if _, err := hook.serialize(entry, fields); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestNestedNamed(t *testing.T) {
+	sink := &memSink{}
+	hook := &CloudwatchHook{Sink: sink}
+	core, err := hook.GetCore(zapcore.DebugLevel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := zap.New(core).Named("parent")
+	logger.Named("sub").Named("leaf").Info("deep")
+	logger.Info("shallow")
+
+	want := []string{"[parent.sub.leaf] deep {}", "[parent] shallow {}"}
+	if got := sink.messages(); len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestNestedNamedHook(t *testing.T) {
+	sink := &memSink{}
+	write, err := (&CloudwatchHook{Sink: sink}).GetHook()
+	if err != nil {
+		t.Fatal(err)
+	}
+	obs, _ := observer.New(zapcore.DebugLevel)
+	logger := zap.New(obs, zap.Hooks(write)).Named("parent").Named("sub")
+	logger.Info("via hook")
+
+	if got := sink.messages(); len(got) != 1 || got[0] != "[parent.sub] via hook" {
+		t.Fatalf("got %q", got)
+	}
+}
+
+func TestStableOutput(t *testing.T) {
+	var fields []zapcore.Field
+	for i := 0; i < 20; i++ {
+		fields = append(fields, zap.Int(fmt.Sprintf("k%02d", (i*7)%20), i))
+	}
+	reversed := make([]zapcore.Field, len(fields))
+	for i, f := range fields {
+		reversed[len(fields)-1-i] = f
+	}
+
+	sink := &memSink{}
+	hook := &CloudwatchHook{Sink: sink}
+	core, err := hook.GetCore(zapcore.DebugLevel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := zap.New(core)
+	for i := 0; i < 50; i++ {
+		logger.Info("stable", fields...)
+		logger.Info("stable", reversed...)
+		logger.With(fields[:10]...).Info("stable", fields[10:]...)
+		logger.With(reversed[:5]...).With(reversed[5:12]...).Info("stable", reversed[12:]...)
+	}
+	hook.Close()
+
+	msgs := sink.messages()
+	for i, msg := range msgs {
+		if msg != msgs[0] {
+			t.Fatalf("event %d is\n%s\nwhile the first is\n%s", i, msg, msgs[0])
+		}
+	}
+	if !strings.HasPrefix(msgs[0], `[] stable {"k00":0,"k01":3,"k02":6,`) {
+		t.Errorf("keys aren't sorted: %s", msgs[0])
+	}
+}
+
+// countingMarshaler counts how often it is encoded
+
+type countingMarshaler struct{ n *int }
+
+func (m countingMarshaler) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	*m.n++
+	enc.AddInt("n", *m.n)
+	return nil
+}
+
+func TestDisabledDoesNoWork(t *testing.T) {
+	sink := &memSink{}
+	hook := &CloudwatchHook{Sink: sink, AcceptedLevels: []zapcore.Level{}}
+	core, err := hook.GetCore(zapcore.DebugLevel)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var encoded int
+	logger := zap.New(core).With(zap.Object("ctx", countingMarshaler{&encoded}))
+	logger.Error("dropped", zap.Object("call", countingMarshaler{&encoded}))
+	if ce := core.Check(zapcore.Entry{Level: zapcore.ErrorLevel}, nil); ce != nil {
+		t.Error("Check added the core despite no accepted levels")
+	}
+	hook.Close()
+
+	if encoded != 0 {
+		t.Errorf("encoded fields %d times", encoded)
+	}
+	if n := sink.puts(); n != 0 {
+		t.Errorf("made %d puts", n)
+	}
+}
+
+func TestHookCoreWith(t *testing.T) {
+	core := &hookCore{LevelEnabler: zapcore.InfoLevel, hook: &CloudwatchHook{}}
+	parent := core.With([]zapcore.Field{zap.String("a", "x")}).(*hookCore)
+	child := parent.With([]zapcore.Field{zap.Int("b", 2)}).(*hookCore)
+
+	if len(core.fields) != 0 || len(parent.fields) != 1 || len(child.fields) != 2 {
+		t.Fatalf("fields %v, %v, %v; want With to leave its receiver alone", core.fields, parent.fields, child.fields)
+	}
+	msg, err := child.hook.formatMessage("hi", child.fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `hi {"a":"x","b":2}`; msg != want {
+		t.Errorf("got %q, want %q", msg, want)
+	}
+
+	if ce := child.Check(zapcore.Entry{Level: zapcore.DebugLevel}, nil); ce != nil {
+		t.Error("core below its level checked an entry")
+	}
+	if ce := child.Check(zapcore.Entry{Level: zapcore.WarnLevel}, nil); ce == nil {
+		t.Error("core didn't check an entry at its level")
+	}
+}
@@ -0,0 +1,119 @@
+package zapcloudwatch
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// stackKey is the key of the field IncludeStacktrace adds
+const stackKey = "stack"
+
+// errorValue encodes an error field as its message or, with ErrorDetails,
+// as an object that also holds the messages of its causes and its stack.
+func (ch *CloudwatchHook) errorValue(err error) interface{} {
+	if !ch.ErrorDetails {
+		return err.Error()
+	}
+
+	details := map[string]interface{}{"message": err.Error()}
+	if causes := errorCauses(err); len(causes) > 0 {
+		details["causes"] = causes
+	}
+	if stack := errorStack(err); stack != "" {
+		details["stack"] = ch.stackValue(stack)
+	}
+	return details
+}
+
+// errorCauses returns the messages of the errors err wraps, nearest first.
+// Errors joining several others contribute all of them.
+func errorCauses(err error) []string {
+	var causes []string
+	queue := unwrapAll(err)
+	for len(queue) > 0 {
+		cause := queue[0]
+		queue = append(queue[1:], unwrapAll(cause)...)
+		causes = append(causes, cause.Error())
+	}
+	return causes
+}
+
+// unwrapAll returns the errors err wraps, leaving out nil ones a careless
+// Unwrap() []error may return
+func unwrapAll(err error) []error {
+	switch u := err.(type) {
+	case interface{ Unwrap() []error }:
+		var causes []error
+		for _, cause := range u.Unwrap() {
+			if cause != nil {
+				causes = append(causes, cause)
+			}
+		}
+		return causes
+	case interface{ Unwrap() error }:
+		if cause := u.Unwrap(); cause != nil {
+			return []error{cause}
+		}
+	}
+	return nil
+}
+
+// errorStack returns the stack of the innermost error in the chain with a
+// StackTrace method, as github.com/pkg/errors adds, or "" if there is none.
+// The method is found by name so that package isn't a dependency.
+func errorStack(err error) string {
+	var stack string
+	queue := []error{err}
+	for len(queue) > 0 {
+		err, queue = queue[0], append(queue[1:], unwrapAll(queue[0])...)
+		m := reflect.ValueOf(err).MethodByName("StackTrace")
+		if m.IsValid() && m.Type().NumIn() == 0 && m.Type().NumOut() == 1 {
+			stack = fmt.Sprintf("%+v", m.Call(nil)[0].Interface())
+		}
+	}
+	return stack
+}
+
+// withStack returns fields followed by the entry's stack, if
+// IncludeStacktrace is set and zap captured one. Coming last, it wins over
+// fields of the same key.
+func (ch *CloudwatchHook) withStack(e zapcore.Entry, fields []zapcore.Field) []zapcore.Field {
+	if !ch.IncludeStacktrace || e.Stack == "" {
+		return fields
+	}
+	all := make([]zapcore.Field, 0, len(fields)+1)
+	all = append(all, fields...)
+	return append(all, zapcore.Field{Key: stackKey, Type: zapcore.ReflectType, Interface: ch.stackValue(e.Stack)})
+}
+
+// stackValue returns a stack as it is encoded: the string itself, or its
+// frames with StackFrames
+func (ch *CloudwatchHook) stackValue(stack string) interface{} {
+	if !ch.StackFrames {
+		return stack
+	}
+	return stackFrames(stack)
+}
+
+// stackFrames splits a stack in the format of zap and github.com/pkg/errors,
+// a function line followed by a tab indented file:line one for every frame,
+// into "function file:line" frames. Lines that don't pair up are frames of
+// their own.
+func stackFrames(stack string) []string {
+	lines := strings.Split(strings.TrimRight(stack, "\n"), "\n")
+	frames := make([]string, 0, len(lines)/2+1)
+	for i := 0; i < len(lines); i++ {
+		frame := strings.TrimSpace(lines[i])
+		if i+1 < len(lines) && strings.HasPrefix(lines[i+1], "\t") {
+			i++
+			frame += " " + strings.TrimSpace(lines[i])
+		}
+		if frame != "" {
+			frames = append(frames, frame)
+		}
+	}
+	return frames
+}
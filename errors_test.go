@@ -0,0 +1,87 @@
+package zapcloudwatch
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// stack stands in for the stack of a github.com/pkg/errors error
+type stack []string
+
+func (s stack) Format(f fmt.State, verb rune) {
+	for _, frame := range s {
+		fmt.Fprintf(f, "\n%s", frame)
+	}
+}
+
+type stackError struct {
+	msg   string
+	stack stack
+}
+
+func (e *stackError) Error() string     { return e.msg }
+func (e *stackError) StackTrace() stack { return e.stack }
+
+// multiError joins errors, some of which may be nil
+type multiError []error
+
+func (e multiError) Error() string   { return "several" }
+func (e multiError) Unwrap() []error { return e }
+
+func TestErrorDetails(t *testing.T) {
+	root := &stackError{msg: "connection reset", stack: stack{"db.query", "main.main"}}
+	chain := fmt.Errorf("charge card: %w", fmt.Errorf("query: %w", root))
+	joined := fmt.Errorf("cleanup: %w", errors.Join(errors.New("close a"), errors.New("close b")))
+
+	tests := []struct {
+		name    string
+		details bool
+		err     error
+		want    string
+	}{
+		{"message only", false, chain, `{"error":"charge card: query: connection reset"}`},
+		{"plain", true, errors.New("boom"), `{"error":{"message":"boom"}}`},
+		{"chain", true, chain, `{"error":{"causes":["query: connection reset","connection reset"],"message":"charge card: query: connection reset","stack":"\ndb.query\nmain.main"}}`},
+		{"joined", true, joined, `{"error":{"causes":["close a\nclose b","close a","close b"],"message":"cleanup: close a\nclose b"}}`},
+		{"nil causes", true, multiError{nil, errors.New("close a"), nil}, `{"error":{"causes":["close a"],"message":"several"}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := encode(t, &CloudwatchHook{ErrorDetails: tt.details}, zap.Error(tt.err)); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStackFrames(t *testing.T) {
+	const zapStack = "main.handle\n\t/app/main.go:42\nmain.main\n\t/app/main.go:10\n"
+	if got, want := fmt.Sprintf("%q", stackFrames(zapStack)), `["main.handle /app/main.go:42" "main.main /app/main.go:10"]`; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	// lines that don't pair up are frames of their own
+	if got, want := fmt.Sprintf("%q", stackFrames("\ndb.query\nmain.main")), `["db.query" "main.main"]`; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+
+	// the entry's stack and an error's are arrays
+	sink := &memSink{}
+	hook := &CloudwatchHook{Sink: sink, IncludeStacktrace: true, StackFrames: true, ErrorDetails: true}
+	core, err := hook.GetCore(zapcore.DebugLevel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := zapcore.Entry{Level: zapcore.ErrorLevel, Message: "failed", Stack: zapStack}
+	if err := core.Write(e, []zapcore.Field{zap.Error(&stackError{msg: "reset", stack: stack{"db.query", "main.main"}})}); err != nil {
+		t.Fatal(err)
+	}
+	hook.Close()
+	want := `[] failed {"error":{"message":"reset","stack":["db.query","main.main"]},"stack":["main.handle /app/main.go:42","main.main /app/main.go:10"]}`
+	if got := sink.messages(); len(got) != 1 || got[0] != want {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+}
@@ -0,0 +1,61 @@
+package zapcloudwatch_test
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/pikabot-org/zapcloudwatch"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func ExampleCloudwatchHook_GetCore() {
+	hook := zapcloudwatch.NewTestHook()
+	cwCore, err := hook.GetCore(zapcore.InfoLevel)
+	if err != nil {
+		panic(err)
+	}
+	consoleCore := zapcore.NewCore(zapcore.NewConsoleEncoder(zapcore.EncoderConfig{
+		MessageKey:  "msg",
+		LevelKey:    "level",
+		EncodeLevel: zapcore.CapitalLevelEncoder,
+	}), zapcore.AddSync(os.Stdout), zapcore.InfoLevel)
+
+	logger := zap.New(zapcore.NewTee(consoleCore, cwCore))
+	logger.Info("payment accepted", zap.Int("amount", 42))
+
+	fmt.Println(hook.Recorded()[0].Message)
+	// Output:
+	// INFO	payment accepted	{"amount": 42}
+	// payment accepted {"amount":42}
+}
+
+// stdoutSink prints the events it is given instead of putting them
+type stdoutSink struct{}
+
+func (stdoutSink) Put(events []*cloudwatchlogs.InputLogEvent) error {
+	for _, e := range events {
+		fmt.Println(aws.StringValue(e.Message))
+	}
+	return nil
+}
+
+func ExampleNewLogger() {
+	logger, closeLogs, err := zapcloudwatch.NewLogger("app", "web-1",
+		zapcloudwatch.WithLevel(zapcore.WarnLevel),
+		zapcloudwatch.Configure(func(h *zapcloudwatch.CloudwatchHook) {
+			h.Sink = stdoutSink{}
+		}),
+	)
+	if err != nil {
+		panic(err)
+	}
+	defer closeLogs()
+
+	logger.Info("not sent")
+	logger.Named("billing").Warn("card declined", zap.String("reason", "expired"))
+	// Output:
+	// [billing] card declined {"reason":"expired"}
+}
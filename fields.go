@@ -0,0 +1,507 @@
+package zapcloudwatch
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// maxSafeInteger is the largest integer a float64 holds exactly, beyond which
+// JavaScript and Logs Insights lose precision
+const maxSafeInteger = 1<<53 - 1
+
+// BoolFormat selects how bool fields are encoded
+type BoolFormat int
+
+const (
+	// BoolJSON encodes bools as JSON true and false.
+	BoolJSON BoolFormat = iota
+	// BoolString encodes bools as the strings "true" and "false".
+	BoolString
+	// BoolNumber encodes bools as the numbers 1 and 0.
+	BoolNumber
+)
+
+// floatValue returns f, or a string for the values JSON has no number for,
+// as zap's own JSON encoder writes them
+func floatValue(f float64) interface{} {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	}
+	return f
+}
+
+// DurationFormat selects how duration fields are encoded
+type DurationFormat int
+
+const (
+	// DurationString encodes durations as Go duration strings like "1.5s".
+	DurationString DurationFormat = iota
+	// DurationMillis encodes durations as fractional milliseconds.
+	DurationMillis
+	// DurationSeconds encodes durations as fractional seconds.
+	DurationSeconds
+	// DurationNanos encodes durations as integer nanoseconds.
+	DurationNanos
+)
+
+// fieldValue converts a zap field into a value that encodes readably as JSON
+func (ch *CloudwatchHook) fieldValue(field zapcore.Field) interface{} {
+	switch field.Type {
+	case zapcore.StringType:
+		return field.String
+	case zapcore.Int64Type, zapcore.Int32Type, zapcore.Int16Type, zapcore.Int8Type:
+		if ch.LargeIntsAsStrings && (field.Integer > maxSafeInteger || field.Integer < -maxSafeInteger) {
+			return strconv.FormatInt(field.Integer, 10)
+		}
+		return field.Integer
+	case zapcore.Uint64Type, zapcore.Uint32Type, zapcore.Uint16Type, zapcore.Uint8Type:
+		// zap stores unsigned values in the same int64, so those above
+		// math.MaxInt64 only read right as uint64
+		u := uint64(field.Integer)
+		if ch.LargeIntsAsStrings && u > maxSafeInteger {
+			return strconv.FormatUint(u, 10)
+		}
+		return u
+	case zapcore.Float64Type:
+		return floatValue(math.Float64frombits(uint64(field.Integer)))
+	case zapcore.Float32Type:
+		return floatValue(float64(math.Float32frombits(uint32(field.Integer))))
+	case zapcore.UintptrType:
+		return uint64(field.Integer)
+	case zapcore.BoolType:
+		switch ch.BoolFormat {
+		case BoolString:
+			return strconv.FormatBool(field.Integer == 1)
+		case BoolNumber:
+			return field.Integer
+		}
+		return field.Integer == 1
+	case zapcore.DurationType:
+		d := time.Duration(field.Integer)
+		switch ch.DurationFormat {
+		case DurationMillis:
+			return float64(d) / float64(time.Millisecond)
+		case DurationSeconds:
+			return d.Seconds()
+		case DurationNanos:
+			return field.Integer
+		}
+		return d.String()
+	case zapcore.TimeType:
+		t := time.Unix(0, field.Integer)
+		if loc, ok := field.Interface.(*time.Location); ok {
+			t = t.In(loc)
+		}
+		return t.Format(time.RFC3339Nano)
+	case zapcore.TimeFullType:
+		if t, ok := field.Interface.(time.Time); ok {
+			return t.Format(time.RFC3339Nano)
+		}
+	case zapcore.ErrorType:
+		if err, ok := field.Interface.(error); ok {
+			return ch.errorValue(err)
+		}
+	case zapcore.BinaryType:
+		if b, ok := field.Interface.([]byte); ok {
+			return base64.StdEncoding.EncodeToString(b)
+		}
+	case zapcore.ByteStringType:
+		if b, ok := field.Interface.([]byte); ok {
+			return string(b)
+		}
+	case zapcore.Complex128Type:
+		if c, ok := field.Interface.(complex128); ok {
+			return strconv.FormatComplex(c, 'g', -1, 128)
+		}
+	case zapcore.Complex64Type:
+		if c, ok := field.Interface.(complex64); ok {
+			return strconv.FormatComplex(complex128(c), 'g', -1, 64)
+		}
+	}
+	return field.Interface
+}
+
+// formatMessage appends the fields, encoded as a JSON object, to the message
+func (ch *CloudwatchHook) formatMessage(msg string, fields []zapcore.Field) (string, error) {
+	obj, err := ch.encodeFields(fields)
+	if err != nil {
+		return "", err
+	}
+	return ch.joinMessage(msg, obj)
+}
+
+// encodeFields encodes the fields, along with any resource metadata, as a
+// single JSON object. Keys are sorted, as are those of nested maps, so the
+// same fields always encode to the same bytes.
+func (ch *CloudwatchHook) encodeFields(fields []zapcore.Field) ([]byte, error) {
+	values := ch.fieldsWithMetadata(fields)
+	return ch.marshalObject(ch.nest(values), values)
+}
+
+// nest returns the object holding values. With FieldsKey set, that is an
+// object with values under FieldsKey, apart from the IndexedFields, which
+// are moved next to it.
+func (ch *CloudwatchHook) nest(values map[string]interface{}) map[string]interface{} {
+	if ch.FieldsKey == "" {
+		return values
+	}
+
+	obj := map[string]interface{}{ch.FieldsKey: values}
+	for k, v := range values {
+		if k != ch.FieldsKey && matchAny(ch.IndexedFields, k) {
+			obj[k] = v
+			delete(values, k)
+		}
+	}
+	return obj
+}
+
+// fieldsWithMetadata is fieldsMap with the resource metadata added
+func (ch *CloudwatchHook) fieldsWithMetadata(fields []zapcore.Field) map[string]interface{} {
+	fieldsMap := ch.fieldsMap(fields)
+	for k, v := range ch.resourceMetadata() {
+		if _, ok := fieldsMap[k]; !ok {
+			fieldsMap[k] = v
+		}
+	}
+	return fieldsMap
+}
+
+// encodeValues encodes every value of m on its own, so the results can be
+// reused in later objects
+func (ch *CloudwatchHook) encodeValues(m map[string]interface{}) (map[string]json.RawMessage, error) {
+	encoded := make(map[string]json.RawMessage, len(m))
+	for k, v := range m {
+		b, err := ch.marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		encoded[k] = b
+	}
+	return encoded, nil
+}
+
+// marshal encodes v with MarshalFunc, or encoding/json if it isn't set
+func (ch *CloudwatchHook) marshal(v interface{}) ([]byte, error) {
+	if ch.MarshalFunc != nil {
+		return ch.MarshalFunc(v)
+	}
+	return json.Marshal(v)
+}
+
+// MarshalErrorPolicy selects what happens to entries with fields that can't
+// be encoded, such as a channel passed to zap.Any
+type MarshalErrorPolicy int
+
+const (
+	// MarshalErrorFail fails the write, so the entry is dropped.
+	MarshalErrorFail MarshalErrorPolicy = iota
+	// MarshalErrorPlaceholder replaces the value of each such field with a
+	// string describing the error and sends the entry anyway.
+	MarshalErrorPlaceholder
+)
+
+// marshalObject encodes obj, the object holding values. If that fails and
+// MarshalErrors allows it, values that can't be encoded are replaced with
+// placeholders and obj is encoded again. values are fixed first, so fields
+// moved to the top level of obj are too without losing the nested ones.
+func (ch *CloudwatchHook) marshalObject(obj, values map[string]interface{}) ([]byte, error) {
+	b, err := ch.encodeObject(obj)
+	if err == nil || ch.MarshalErrors != MarshalErrorPlaceholder {
+		return b, err
+	}
+
+	for _, m := range []map[string]interface{}{values, obj} {
+		for k, v := range m {
+			if _, verr := ch.marshal(v); verr != nil {
+				m[k] = fmt.Sprintf("(unencodable: %v)", verr)
+			}
+		}
+	}
+	return ch.encodeObject(obj)
+}
+
+// encodeObject encodes obj with the keys named in FieldOrder first, in that
+// order, and the others after them, sorted.
+func (ch *CloudwatchHook) encodeObject(obj map[string]interface{}) ([]byte, error) {
+	if len(ch.FieldOrder) == 0 {
+		return ch.marshal(obj)
+	}
+
+	keys := make([]string, 0, len(obj))
+	first := make(map[string]bool, len(ch.FieldOrder))
+	for _, k := range ch.FieldOrder {
+		if _, ok := obj[k]; ok && !first[k] {
+			first[k] = true
+			keys = append(keys, k)
+		}
+	}
+	rest := make([]string, 0, len(obj)-len(keys))
+	for k := range obj {
+		if !first[k] {
+			rest = append(rest, k)
+		}
+	}
+	sort.Strings(rest)
+	keys = append(keys, rest...)
+
+	buf := []byte{'{'}
+	for i, k := range keys {
+		key, err := ch.marshal(k)
+		if err != nil {
+			return nil, err
+		}
+		value, err := ch.marshal(obj[k])
+		if err != nil {
+			return nil, err
+		}
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		buf = append(buf, key...)
+		buf = append(buf, ':')
+		buf = append(buf, value...)
+	}
+	return append(buf, '}'), nil
+}
+
+// resourceMetadata returns the metadata looked up during setup, along with
+// the source tag. It is only safe to read once setup has finished.
+func (ch *CloudwatchHook) resourceMetadata() map[string]string {
+	if !ch.ready.Load() {
+		return nil
+	}
+	return ch.metadata
+}
+
+// dropFields removes the fields whose keys match one of the DropFields
+// patterns for level. fields is returned as is if nothing is dropped.
+func (ch *CloudwatchHook) dropFields(level zapcore.Level, fields []zapcore.Field) []zapcore.Field {
+	patterns := ch.DropFields[level]
+	if len(patterns) == 0 {
+		return fields
+	}
+
+	kept := make([]zapcore.Field, 0, len(fields))
+	for _, field := range fields {
+		if !matchAny(patterns, field.Key) {
+			kept = append(kept, field)
+		}
+	}
+	return kept
+}
+
+// matchAny reports whether key matches one of the path.Match patterns
+func matchAny(patterns []string, key string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// fieldsMap converts the fields into a map of JSON encodable values
+func (ch *CloudwatchHook) fieldsMap(fields []zapcore.Field) map[string]interface{} {
+	set := &fieldSet{m: make(map[string]interface{}, len(fields)), policy: ch.DuplicateKeys, reserved: ch.ReservedKeys}
+	for _, field := range fields {
+		if field.Type == zapcore.SkipType {
+			ch.addContextFields(set, field)
+			continue
+		}
+		switch field.Type {
+		case zapcore.InlineMarshalerType, zapcore.ObjectMarshalerType, zapcore.ArrayMarshalerType, zapcore.StringerType:
+			// let zap expand marshalers into maps and slices json can encode.
+			// Inline objects add their keys next to the other fields, and a
+			// marshaler that fails adds a <key>Error field, as zap has it.
+			enc := zapcore.NewMapObjectEncoder()
+			field.AddTo(enc)
+			for k, v := range enc.Fields {
+				set.add(k, ch.limitField(v))
+			}
+			continue
+		}
+		set.add(field.Key, ch.limitField(ch.fieldValue(field)))
+	}
+	return set.m
+}
+
+// limitField truncates string values to MaxFieldLength
+func (ch *CloudwatchHook) limitField(value interface{}) interface{} {
+	if str, ok := value.(string); ok && ch.MaxFieldLength > 0 {
+		return truncate(str, ch.MaxFieldLength, ch.TruncationSuffix)
+	}
+	return value
+}
+
+// DuplicateKeyPolicy selects what happens when several fields share a key
+type DuplicateKeyPolicy int
+
+const (
+	// DuplicateLastWins keeps only the last field with a key.
+	DuplicateLastWins DuplicateKeyPolicy = iota
+	// DuplicateRename keeps every field, renaming repeats to key#01, key#02...
+	DuplicateRename
+	// DuplicateArray collects the values of repeated keys into an array.
+	DuplicateArray
+)
+
+// ReservedKeyPolicy selects what happens to fields whose key starts with @,
+// like the fields Logs Insights adds itself, e.g. @timestamp and @message
+type ReservedKeyPolicy int
+
+const (
+	// ReservedKeysAllow keeps such fields as they are, shadowing the fields
+	// of the same name in Logs Insights.
+	ReservedKeysAllow ReservedKeyPolicy = iota
+	// ReservedKeysRename replaces the leading @ with _, e.g. _message.
+	ReservedKeysRename
+	// ReservedKeysDrop leaves such fields out.
+	ReservedKeysDrop
+)
+
+// reservedKey returns the key to use for a field, and false if the field is
+// left out
+func reservedKey(key string, policy ReservedKeyPolicy) (string, bool) {
+	if !strings.HasPrefix(key, "@") {
+		return key, true
+	}
+	switch policy {
+	case ReservedKeysRename:
+		return "_" + key[1:], true
+	case ReservedKeysDrop:
+		return "", false
+	}
+	return key, true
+}
+
+// fieldSet collects field values, resolving duplicate and reserved keys by
+// policy
+type fieldSet struct {
+	m        map[string]interface{}
+	counts   map[string]int
+	policy   DuplicateKeyPolicy
+	reserved ReservedKeyPolicy
+}
+
+func (s *fieldSet) add(key string, value interface{}) {
+	key, ok := reservedKey(key, s.reserved)
+	if !ok {
+		return
+	}
+	prev, dup := s.m[key]
+	if !dup || s.policy == DuplicateLastWins {
+		s.m[key] = value
+		return
+	}
+
+	if s.counts == nil {
+		s.counts = make(map[string]int)
+	}
+	s.counts[key]++
+	n := s.counts[key]
+
+	switch s.policy {
+	case DuplicateRename:
+		s.m[fmt.Sprintf("%s#%02d", key, n)] = value
+	case DuplicateArray:
+		if n == 1 {
+			s.m[key] = []interface{}{prev, value}
+		} else {
+			s.m[key] = append(prev.([]interface{}), value)
+		}
+	}
+}
+
+// joinMessage appends an encoded fields object to the message
+func (ch *CloudwatchHook) joinMessage(msg string, obj []byte) (string, error) {
+	sep := ch.FieldsSeparator
+	if sep == "" {
+		sep = " "
+	}
+	return msg + sep + string(obj), nil
+}
+
+// UTF8Policy selects what happens to invalid UTF-8 in event messages, such
+// as binary data that leaked into a string
+type UTF8Policy int
+
+const (
+	// UTF8Keep sends messages as they are.
+	UTF8Keep UTF8Policy = iota
+	// UTF8Replace replaces each invalid sequence with U+FFFD.
+	UTF8Replace
+	// UTF8Escape replaces each invalid byte with its \xNN escape.
+	UTF8Escape
+)
+
+// sanitizeUTF8 applies policy to the invalid UTF-8 in s
+func sanitizeUTF8(s string, policy UTF8Policy) string {
+	if policy == UTF8Keep || utf8.ValidString(s) {
+		return s
+	}
+	if policy == UTF8Replace {
+		return strings.ToValidUTF8(s, string(utf8.RuneError))
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			fmt.Fprintf(&b, "\\x%02x", s[i])
+		} else {
+			b.WriteString(s[i : i+size])
+		}
+		i += size
+	}
+	return b.String()
+}
+
+// truncate cuts s down to at most max bytes, suffix included, without
+// splitting a multi-byte character.
+func truncate(s string, max int, suffix string) string {
+	if len(s) <= max {
+		return s
+	}
+	if len(suffix) >= max {
+		suffix = ""
+	}
+
+	cut := max - len(suffix)
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + suffix
+}
+
+// appendRoom is the most bytes added to a message after it is truncated, by
+// ContentHash, BatchIDs and CoalesceWindow, which MaxMessageLength leaves
+// room for
+func (ch *CloudwatchHook) appendRoom() int {
+	var room int
+	if ch.ContentHash {
+		room += ch.hashRoom()
+	}
+	if ch.BatchIDs {
+		room += len(ch.appendFields("", batchIDKey, newBatchID()))
+	}
+	if ch.CoalesceWindow > 0 {
+		room += len(ch.repeated("", math.MaxInt))
+	}
+	return room
+}
@@ -0,0 +1,586 @@
+package zapcloudwatch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// encode returns the JSON object the hook encodes fields to
+func encode(t *testing.T, ch *CloudwatchHook, fields ...zapcore.Field) string {
+	t.Helper()
+	obj, err := ch.encodeFields(fields)
+	if err != nil {
+		t.Fatalf("encoding %v: %v", fields, err)
+	}
+	return string(obj)
+}
+
+func TestFieldEncodings(t *testing.T) {
+	tests := []struct {
+		name  string
+		field zapcore.Field
+		want  string
+	}{
+		{"binary", zap.Binary("b", []byte{0xde, 0xad, 0xbe, 0xef}), `{"b":"3q2+7w=="}`},
+		{"byte string", zap.ByteString("s", []byte("héllo")), `{"s":"héllo"}`},
+		{"complex128", zap.Complex128("c", complex(1.5, -2)), `{"c":"(1.5-2i)"}`},
+		{"complex64", zap.Complex64("c", complex64(complex(3, 0.25))), `{"c":"(3+0.25i)"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := encode(t, &CloudwatchHook{}, tt.field); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBoolFormat(t *testing.T) {
+	tests := []struct {
+		format BoolFormat
+		want   string
+	}{
+		{BoolJSON, `{"no":false,"yes":true}`},
+		{BoolString, `{"no":"false","yes":"true"}`},
+		{BoolNumber, `{"no":0,"yes":1}`},
+	}
+	for _, tt := range tests {
+		ch := &CloudwatchHook{BoolFormat: tt.format}
+		if got := encode(t, ch, zap.Bool("yes", true), zap.Bool("no", false)); got != tt.want {
+			t.Errorf("format %d: got %s, want %s", tt.format, got, tt.want)
+		}
+	}
+}
+
+func TestTruncateUTF8(t *testing.T) {
+	tests := []struct {
+		name   string
+		s      string
+		max    int
+		suffix string
+		want   string
+	}{
+		{"fits", "héllo", 6, "…", "héllo"},
+		{"ascii", "hello world", 5, "", "hello"},
+		{"inside a two byte rune", "héllo", 2, "", "h"},
+		{"inside a four byte rune", "ok😀😀", 5, "", "ok"},
+		{"after a rune", "ok😀😀", 6, "", "ok😀"},
+		{"with suffix", "日本語テキスト", 12, "...", "日本語..."},
+		{"suffix longer than max", "日本語", 4, "[truncated]", "日"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := truncate(tt.s, tt.max, tt.suffix)
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			if len(got) > tt.max {
+				t.Errorf("%q is %d bytes, over %d", got, len(got), tt.max)
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("%q isn't valid UTF-8", got)
+			}
+		})
+	}
+}
+
+func TestMaxMessageLength(t *testing.T) {
+	sink := &memSink{}
+	hook := &CloudwatchHook{Sink: sink, MaxMessageLength: 16, TruncationSuffix: "…"}
+	if _, err := hook.GetHook(); err != nil {
+		t.Fatal(err)
+	}
+	if err := hook.write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "ünïcödé messägé"}); err != nil {
+		t.Fatal(err)
+	}
+	msgs := sink.messages()
+	if len(msgs) != 1 || len(msgs[0]) > 16 || !utf8.ValidString(msgs[0]) || !strings.HasSuffix(msgs[0], "…") {
+		t.Fatalf("delivered %q", msgs)
+	}
+}
+
+func TestMaxMessageLengthAddedFields(t *testing.T) {
+	const max = 250
+	for _, format := range []Format{FormatText, FormatJSON} {
+		sink := &memSink{}
+		hook := &CloudwatchHook{Sink: sink, Format: format, MaxMessageLength: max, TruncationSuffix: "...",
+			BatchIDs: true, ContentHash: true, CoalesceWindow: time.Hour}
+		for i := 0; i < 3; i++ {
+			hook.AddMessage(zapcore.InfoLevel, strings.Repeat("a", 300))
+		}
+		if err := hook.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		// the batch id and repeat count are added after truncation
+		msgs := sink.messages()
+		if len(msgs) != 1 || !strings.Contains(msgs[0], batchIDKey) || !strings.Contains(msgs[0], "repeated") {
+			t.Fatalf("format %d: delivered %q", format, msgs)
+		}
+		if len(msgs[0]) > max {
+			t.Errorf("format %d: %d byte message, over the %d limit: %q", format, len(msgs[0]), max, msgs[0])
+		}
+	}
+}
+
+func TestMaxFieldLength(t *testing.T) {
+	const limit = 1024
+	sink := &memSink{}
+	hook := &CloudwatchHook{Sink: sink, MaxFieldLength: limit, TruncationSuffix: "[cut]"}
+	core, err := hook.GetCore(zapcore.DebugLevel)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := strings.Repeat("x", 1<<20)
+	zap.New(core).Info("request", zap.String("body", body), zap.String("method", "POST"))
+
+	msgs := sink.messages()
+	if len(msgs) != 1 {
+		t.Fatalf("got %d events", len(msgs))
+	}
+	var fields map[string]string
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(msgs[0], "[] request ")), &fields); err != nil {
+		t.Fatal(err)
+	}
+	if got := fields["body"]; len(got) != limit || !strings.HasSuffix(got, "[cut]") {
+		t.Errorf("body is %d bytes ending %q, want %d ending [cut]", len(got), got[len(got)-8:], limit)
+	}
+	if fields["method"] != "POST" {
+		t.Errorf("short field changed to %q", fields["method"])
+	}
+}
+
+func TestUnsignedFields(t *testing.T) {
+	tests := []struct {
+		name  string
+		field zapcore.Field
+		want  string
+	}{
+		{"max uint64", zap.Uint64("big", math.MaxUint64), `{"big":18446744073709551615}`},
+		{"above max int64", zap.Uint64("big", math.MaxInt64+1), `{"big":9223372036854775808}`},
+		{"max uint32", zap.Uint32("n", math.MaxUint32), `{"n":4294967295}`},
+		{"max uint8", zap.Uint8("n", math.MaxUint8), `{"n":255}`},
+		{"uintptr", zap.Uintptr("p", math.MaxUint64), `{"p":18446744073709551615}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := encode(t, &CloudwatchHook{}, tt.field); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	// through the core and in the JSON format too
+	sink := &memSink{}
+	core, err := (&CloudwatchHook{Sink: sink, Format: FormatJSON}).GetCore(zapcore.DebugLevel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := zap.New(core)
+	logger.Info("hi", zap.Uint64("big", math.MaxUint64))
+	logger.Sync()
+	if got := sink.messages(); len(got) != 1 || !strings.Contains(got[0], `"big":18446744073709551615`) {
+		t.Errorf("core: got %q", got)
+	}
+}
+
+func TestLargeIntsAsStrings(t *testing.T) {
+	tests := []struct {
+		name  string
+		field zapcore.Field
+		want  string
+	}{
+		{"safe", zap.Int64("n", 1<<53-1), `{"n":9007199254740991}`},
+		{"large", zap.Int64("n", 1<<53), `{"n":"9007199254740992"}`},
+		{"negative", zap.Int64("n", -1<<53), `{"n":"-9007199254740992"}`},
+		{"safe uint", zap.Uint64("n", 1<<53-1), `{"n":9007199254740991}`},
+		{"large uint", zap.Uint64("n", 1<<64-1), `{"n":"18446744073709551615"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := encode(t, &CloudwatchHook{LargeIntsAsStrings: true}, tt.field); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	// without the option they stay numbers
+	if got := encode(t, &CloudwatchHook{}, zap.Int64("n", 1<<53)); got != `{"n":9007199254740992}` {
+		t.Errorf("got %s, want a number", got)
+	}
+}
+
+type user struct {
+	name  string
+	roles []string
+}
+
+func (u user) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("name", u.name)
+	return enc.AddArray("roles", zapcore.ArrayMarshalerFunc(func(arr zapcore.ArrayEncoder) error {
+		for _, r := range u.roles {
+			arr.AppendString(r)
+		}
+		return nil
+	}))
+}
+
+type hostPort int
+
+func (p hostPort) String() string {
+	return fmt.Sprintf("localhost:%d", int(p))
+}
+
+// brokenStringer panics when formatted
+type brokenStringer struct{}
+
+func (brokenStringer) String() string {
+	panic("unresolved")
+}
+
+func TestMarshalers(t *testing.T) {
+	u := user{name: "ana", roles: []string{"admin", "dev"}}
+	failing := zapcore.ObjectMarshalerFunc(func(enc zapcore.ObjectEncoder) error {
+		enc.AddString("name", "ana")
+		return errors.New("no roles")
+	})
+	tests := []struct {
+		name  string
+		field zapcore.Field
+		want  string
+	}{
+		{"object", zap.Object("user", u), `{"user":{"name":"ana","roles":["admin","dev"]}}`},
+		{"array", zap.Strings("tags", []string{"a", "b"}), `{"tags":["a","b"]}`},
+		{"objects", zap.Objects("users", []user{u}), `{"users":[{"name":"ana","roles":["admin","dev"]}]}`},
+		{"inline", zap.Inline(u), `{"name":"ana","roles":["admin","dev"]}`},
+		{"stringer", zap.Stringer("addr", hostPort(80)), `{"addr":"localhost:80"}`},
+		{"failing object", zap.Object("user", failing), `{"user":{"name":"ana"},"userError":"no roles"}`},
+		{"panicking stringer", zap.Stringer("addr", brokenStringer{}), `{"addrError":"PANIC=unresolved"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := encode(t, &CloudwatchHook{}, tt.field); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDuplicateKeys(t *testing.T) {
+	tests := []struct {
+		policy DuplicateKeyPolicy
+		want   string
+	}{
+		{DuplicateLastWins, `{"id":3}`},
+		{DuplicateRename, `{"id":1,"id#01":2,"id#02":3}`},
+		{DuplicateArray, `{"id":[1,2,3]}`},
+	}
+	for _, tt := range tests {
+		ch := &CloudwatchHook{DuplicateKeys: tt.policy}
+		if got := encode(t, ch, zap.Int("id", 1), zap.Int("id", 2), zap.Int("id", 3)); got != tt.want {
+			t.Errorf("policy %d: got %s, want %s", tt.policy, got, tt.want)
+		}
+	}
+}
+
+func TestDuplicateKeysAcrossWith(t *testing.T) {
+	tests := []struct {
+		policy DuplicateKeyPolicy
+		want   string
+	}{
+		{DuplicateLastWins, `[] hi {"id":"call","other":1}`},
+		{DuplicateRename, `[] hi {"id":"with","id#01":"call","other":1}`},
+		{DuplicateArray, `[] hi {"id":["with","call"],"other":1}`},
+	}
+	for _, tt := range tests {
+		sink := &memSink{}
+		hook := &CloudwatchHook{Sink: sink, DuplicateKeys: tt.policy}
+		core, err := hook.GetCore(zapcore.DebugLevel)
+		if err != nil {
+			t.Fatal(err)
+		}
+		zap.New(core).With(zap.String("id", "with"), zap.Int("other", 1)).Info("hi", zap.String("id", "call"))
+		hook.Close()
+
+		if got := sink.messages(); len(got) != 1 || got[0] != tt.want {
+			t.Errorf("policy %d: got %q, want %s", tt.policy, got, tt.want)
+		}
+	}
+}
+
+// marshalNoEscape is an alternative MarshalFunc leaving HTML characters
+// unescaped
+func marshalNoEscape(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+func TestMarshalFunc(t *testing.T) {
+	fields := []zapcore.Field{zap.String("html", "<b>&</b>"), zap.Int("n", 1), zap.Strings("tags", []string{"a"})}
+
+	if got, want := encode(t, &CloudwatchHook{}, fields...), `{"html":"\u003cb\u003e\u0026\u003c/b\u003e","n":1,"tags":["a"]}`; got != want {
+		t.Errorf("default: got %s, want %s", got, want)
+	}
+	ch := &CloudwatchHook{MarshalFunc: marshalNoEscape}
+	if got, want := encode(t, ch, fields...), `{"html":"<b>&</b>","n":1,"tags":["a"]}`; got != want {
+		t.Errorf("MarshalFunc: got %s, want %s", got, want)
+	}
+
+	// it is used through the core too, cached fields included
+	sink := &memSink{}
+	ch.Sink = sink
+	core, err := ch.GetCore(zapcore.DebugLevel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zap.New(core).With(zap.String("a", "<")).Info("hi", zap.String("b", ">"))
+	ch.Close()
+	if got := sink.messages(); len(got) != 1 || got[0] != `[] hi {"a":"<","b":">"}` {
+		t.Errorf("core: got %q", got)
+	}
+}
+
+func benchmarkEncodeFields(b *testing.B, ch *CloudwatchHook) {
+	fields := []zapcore.Field{
+		zap.String("request_id", "3f2a9c"),
+		zap.Int("status", 200),
+		zap.Duration("latency", 1500),
+		zap.Strings("tags", []string{"a", "b", "c"}),
+		zap.Float64("ratio", 0.25),
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := ch.encodeFields(fields); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEncodeFields(b *testing.B) {
+	benchmarkEncodeFields(b, &CloudwatchHook{})
+}
+
+func BenchmarkEncodeFieldsMarshalFunc(b *testing.B) {
+	benchmarkEncodeFields(b, &CloudwatchHook{MarshalFunc: marshalNoEscape})
+}
+
+func TestDurationFormat(t *testing.T) {
+	tests := []struct {
+		format DurationFormat
+		want   string
+	}{
+		{DurationString, `{"d":"1.5s"}`},
+		{DurationMillis, `{"d":1500}`},
+		{DurationSeconds, `{"d":1.5}`},
+		{DurationNanos, `{"d":1500000000}`},
+	}
+	for _, tt := range tests {
+		ch := &CloudwatchHook{DurationFormat: tt.format}
+		if got := encode(t, ch, zap.Duration("d", 1500*time.Millisecond)); got != tt.want {
+			t.Errorf("format %d: got %s, want %s", tt.format, got, tt.want)
+		}
+	}
+}
+
+func TestTimeFields(t *testing.T) {
+	tokyo := time.FixedZone("JST", 9*60*60)
+	tests := []struct {
+		name  string
+		field zapcore.Field
+		want  string
+	}{
+		{"utc", zap.Time("t", time.Date(2024, 3, 1, 12, 30, 0, 500, time.UTC)), `{"t":"2024-03-01T12:30:00.0000005Z"}`},
+		{"zone kept", zap.Time("t", time.Date(2024, 3, 1, 21, 0, 0, 0, tokyo)), `{"t":"2024-03-01T21:00:00+09:00"}`},
+		// times outside the range of int64 nanoseconds are kept whole by zap
+		{"far future", zap.Time("t", time.Date(3000, 1, 1, 0, 0, 0, 0, time.UTC)), `{"t":"3000-01-01T00:00:00Z"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := encode(t, &CloudwatchHook{}, tt.field); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDropFields(t *testing.T) {
+	sink := &memSink{}
+	hook := &CloudwatchHook{Sink: sink, DropFields: map[zapcore.Level][]string{
+		zapcore.InfoLevel:  {"debug_*", "sql"},
+		zapcore.ErrorLevel: {"payload"},
+	}}
+	core, err := hook.GetCore(zapcore.DebugLevel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := zap.New(core).With(zap.String("debug_conn", "c1"), zap.String("req", "r1"))
+
+	logger.Debug("d", zap.String("sql", "select 1"))
+	logger.Info("i", zap.String("sql", "select 1"), zap.Int("debug_rows", 3), zap.Int("rows", 3))
+	logger.Error("e", zap.String("payload", "{...}"), zap.String("sql", "select 1"))
+	hook.Close()
+
+	want := []string{
+		`[] d {"debug_conn":"c1","req":"r1","sql":"select 1"}`,
+		`[] i {"req":"r1","rows":3}`,
+		`[] e {"debug_conn":"c1","req":"r1","sql":"select 1"}`,
+	}
+	got := sink.messages()
+	if len(got) != len(want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("event %d = %s, want %s", i, got[i], want[i])
+		}
+	}
+}
+
+func TestMarshalErrorPlaceholder(t *testing.T) {
+	fields := []zapcore.Field{zap.Any("c", make(chan int)), zap.Int("n", 1)}
+
+	if _, err := (&CloudwatchHook{}).encodeFields(fields); err == nil {
+		t.Error("MarshalErrorFail: encoded a channel")
+	}
+	got := encode(t, &CloudwatchHook{MarshalErrors: MarshalErrorPlaceholder}, fields...)
+	if !strings.HasPrefix(got, `{"c":"(unencodable: `) || !strings.HasSuffix(got, `)","n":1}`) {
+		t.Errorf("got %s, want a placeholder for c and n kept", got)
+	}
+
+	// the entry is sent through the core instead of dropped
+	sink := &memSink{}
+	core, err := (&CloudwatchHook{Sink: sink, MarshalErrors: MarshalErrorPlaceholder}).GetCore(zapcore.DebugLevel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := zap.New(core)
+	logger.Info("hi", fields...)
+	logger.Sync()
+	if got := sink.messages(); len(got) != 1 || !strings.Contains(got[0], `"n":1`) {
+		t.Errorf("core: got %q, want the entry sent", got)
+	}
+}
+
+func TestFieldOrder(t *testing.T) {
+	entry := zapcore.Entry{Level: zapcore.InfoLevel, Message: "paid"}
+	fields := []zapcore.Field{zap.Int("amount", 3), zap.String("id", "x1"), zap.Bool("ok", true)}
+	// keys missing from the object and repeated ones are skipped
+	order := []string{"msg", "missing", "level", "ok", "msg"}
+	tests := []struct {
+		format Format
+		want   string
+	}{
+		{FormatJSON, `{"msg":"paid","level":"info","ok":true,"amount":3,"id":"x1"}`},
+		{FormatText, `paid {"ok":true,"amount":3,"id":"x1"}`},
+	}
+	for _, tt := range tests {
+		ch := &CloudwatchHook{Format: tt.format, FieldOrder: order}
+		if got := serialized(t, ch, entry, fields...); got != tt.want {
+			t.Errorf("format %d: got %s, want %s", tt.format, got, tt.want)
+		}
+	}
+
+	// fields added with With are ordered along with the entry's own
+	sink := &memSink{}
+	core, err := (&CloudwatchHook{Sink: sink, Format: FormatJSON, FieldOrder: []string{"id", "msg"}}).GetCore(zapcore.DebugLevel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := zap.New(core).With(zap.String("id", "x1"))
+	logger.Info("paid", zap.Int("amount", 3))
+	logger.Sync()
+	if got := sink.messages(); len(got) != 1 || got[0] != `{"id":"x1","msg":"paid","amount":3,"level":"info"}` {
+		t.Errorf("core: got %q", got)
+	}
+}
+
+func TestReservedKeys(t *testing.T) {
+	fields := []zapcore.Field{zap.String("@message", "spoofed"), zap.Int("@timestamp", 1), zap.String("user", "ann")}
+	tests := []struct {
+		policy ReservedKeyPolicy
+		want   string
+	}{
+		{ReservedKeysAllow, `{"@message":"spoofed","@timestamp":1,"user":"ann"}`},
+		{ReservedKeysRename, `{"_message":"spoofed","_timestamp":1,"user":"ann"}`},
+		{ReservedKeysDrop, `{"user":"ann"}`},
+	}
+	for _, tt := range tests {
+		if got := encode(t, &CloudwatchHook{ReservedKeys: tt.policy}, fields...); got != tt.want {
+			t.Errorf("policy %d: got %s, want %s", tt.policy, got, tt.want)
+		}
+	}
+
+	// the real message stays where it is, fields added with With too
+	sink := &memSink{}
+	core, err := (&CloudwatchHook{Sink: sink, Format: FormatJSON, ReservedKeys: ReservedKeysRename}).GetCore(zapcore.DebugLevel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := zap.New(core).With(zap.String("@message", "spoofed"))
+	logger.Info("real")
+	logger.Sync()
+	if got := sink.messages(); len(got) != 1 || got[0] != `{"_message":"spoofed","level":"info","msg":"real"}` {
+		t.Errorf("core: got %q", got)
+	}
+}
+
+func TestInvalidUTF8(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy UTF8Policy
+		want   string // empty when the put is rejected
+	}{
+		{"keep", UTF8Keep, ""},
+		{"replace", UTF8Replace, "[] bin \uFFFD data"},
+		{"escape", UTF8Escape, `[] bin \xff\xfe data`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// cloudwatch rejects events that aren't valid UTF-8
+			m := &mockLogs{onPut: func(in *cloudwatchlogs.PutLogEventsInput) error {
+				for _, event := range in.LogEvents {
+					if !utf8.ValidString(aws.StringValue(event.Message)) {
+						return awserr.New(cloudwatchlogs.ErrCodeInvalidParameterException, "invalid UTF-8", nil)
+					}
+				}
+				return nil
+			}}
+			m.addStream("group", "stream")
+			var errs []error
+			hook := &CloudwatchHook{GroupName: "group", StreamName: "stream", Client: m, InvalidUTF8: tt.policy,
+				OnError: func(err error) { errs = append(errs, err) }}
+			hook.AddMessage(zapcore.InfoLevel, "bin \xff\xfe data")
+			hook.Close()
+
+			if tt.want == "" {
+				if len(errs) == 0 {
+					t.Error("invalid UTF-8 was put")
+				}
+				return
+			}
+			if len(errs) > 0 {
+				t.Errorf("put failed: %v", errs)
+			}
+			checkMessages(t, m, "group", "stream", tt.want)
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package zapcloudwatch
+
+import "sync"
+
+// creates coalesces the group and stream creations of hooks setting up at
+// the same time, so a pool of workers each making a hook for one stream
+// creates it once. Hooks of other accounts or regions that happen to share
+// a call find their stream missing on the first put, which creates it then.
+var creates flightGroup
+
+// flightGroup runs one call per key at a time, sharing its result with
+// callers that ask for the same key while it runs
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+type flightCall struct {
+	wg  sync.WaitGroup
+	err error
+}
+
+// do calls fn, unless a call for key is already running, in which case it
+// waits for that one and returns its error
+func (g *flightGroup) do(key string, fn func() error) error {
+	g.mu.Lock()
+	if c, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		c.wg.Wait()
+		return c.err
+	}
+	c := &flightCall{}
+	c.wg.Add(1)
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall)
+	}
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	c.err = fn()
+	c.wg.Done()
+
+	g.mu.Lock()
+	delete(g.calls, key)
+	g.mu.Unlock()
+	return c.err
+}
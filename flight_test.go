@@ -0,0 +1,55 @@
+package zapcloudwatch
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConcurrentSetupsCreateOnce(t *testing.T) {
+	const hooks = 8
+	// every hook finds the group and stream missing before any creates them
+	var groups, streams sync.WaitGroup
+	groups.Add(hooks)
+	streams.Add(hooks)
+	m := &mockLogs{
+		onDescribeGroups: func() error {
+			groups.Done()
+			groups.Wait()
+			return nil
+		},
+		onDescribeStreams: func() error {
+			streams.Done()
+			streams.Wait()
+			return nil
+		},
+		// a create slow enough for the others to join it
+		onCreateGroup:  func() error { time.Sleep(50 * time.Millisecond); return nil },
+		onCreateStream: func() error { time.Sleep(50 * time.Millisecond); return nil },
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, hooks)
+	for i := 0; i < hooks; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			hook := &CloudwatchHook{GroupName: "flight", StreamName: "workers", Client: m}
+			_, err := hook.GetHook()
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := m.count("CreateLogGroup"); n != 1 {
+		t.Errorf("created the group %d times, want once", n)
+	}
+	if n := m.count("CreateLogStream"); n != 1 {
+		t.Errorf("created the stream %d times, want once", n)
+	}
+}
@@ -0,0 +1,200 @@
+package zapcloudwatch
+
+import (
+	"errors"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ErrClosed is returned for entries written after the hook was closed.
+var ErrClosed = errors.New("zapcloudwatch: hook is closed")
+
+// ErrCloseTimeout is returned when closing gave up on undelivered events.
+var ErrCloseTimeout = errors.New("zapcloudwatch: timed out delivering events on close")
+
+// Flush puts any buffered events and blocks until every event sent
+// asynchronously so far has been delivered
+func (ch *CloudwatchHook) Flush() error {
+	ch.flushCoalesced()
+	err := ch.flushBuffer()
+	ch.pending.wait()
+	for _, child := range ch.children() {
+		if cerr := child.Flush(); err == nil {
+			err = cerr
+		}
+	}
+	if merr := ch.Metrics.Flush(); err == nil {
+		err = merr
+	}
+	return err
+}
+
+// Close flushes the hook. Entries written after Close are rejected with
+// ErrClosed. If CloseTimeout is set it behaves like CloseWithTimeout.
+func (ch *CloudwatchHook) Close() error {
+	if ch.CloseTimeout > 0 {
+		return ch.CloseWithTimeout(ch.CloseTimeout)
+	}
+	ch.closed.Store(true)
+	for _, child := range ch.children() {
+		child.closed.Store(true)
+	}
+	err := ch.Resume()
+	if ferr := ch.Flush(); err == nil {
+		err = ferr
+	}
+	return err
+}
+
+// CloseWithTimeout is like Close but gives up on delivery after d, so a stuck
+// connection can't hang shutdown. Events still buffered at that point go to
+// the fallback writer and sink instead, and it returns ErrCloseTimeout.
+// Events whose put is already in flight are lost unless SpoolDir is set, in
+// which case they're replayed by the next process.
+func (ch *CloudwatchHook) CloseWithTimeout(d time.Duration) error {
+	ch.closed.Store(true)
+	for _, child := range ch.children() {
+		child.closed.Store(true)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		err := ch.Resume()
+		if ferr := ch.Flush(); err == nil {
+			err = ferr
+		}
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(d):
+	}
+
+	ch.abandon()
+	return ErrCloseTimeout
+}
+
+// abandon hands everything still buffered to the fallback writer and sink
+func (ch *CloudwatchHook) abandon() {
+	ch.dup.mu.Lock()
+	held, _ := ch.dup.take(ch.repeated)
+	ch.dup.mu.Unlock()
+
+	ch.bufMu.Lock()
+	batch, _ := ch.takeBuffer()
+	ch.bufMu.Unlock()
+
+	if held != nil {
+		batch = append(batch, held)
+	}
+	if len(batch) > 0 {
+		ch.acknowledge(batch, ErrCloseTimeout)
+		ch.writeFallback(batch)
+	}
+	for _, child := range ch.children() {
+		child.abandon()
+	}
+}
+
+// FlushOnSignal closes the hook when one of the given signals arrives, so
+// buffered logs are delivered before the process dies. It defaults to SIGTERM
+// and os.Interrupt. Once closed the signal is raised again so its default
+// action still takes place. Apps that handle signals themselves should call
+// Close from their own handler instead. The returned function unregisters
+// the handler.
+func (ch *CloudwatchHook) FlushOnSignal(signals ...os.Signal) (stop func()) {
+	if len(signals) == 0 {
+		signals = []os.Signal{syscall.SIGTERM, os.Interrupt}
+	}
+
+	c := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(c, signals...)
+
+	go func() {
+		select {
+		case sig := <-c:
+			ch.Close()
+			signal.Stop(c)
+			if p, err := os.FindProcess(os.Getpid()); err == nil {
+				p.Signal(sig)
+			}
+		case <-done:
+		}
+	}()
+
+	var stopped bool
+	return func() {
+		if stopped {
+			return
+		}
+		stopped = true
+		signal.Stop(c)
+		close(done)
+	}
+}
+
+// drain counts background work by the generation it started in, so a wait
+// blocks for the work started before it and not for what starts meanwhile,
+// which under steady logging might never stop. The zero value is ready to
+// use.
+type drain struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+	gen  uint64
+	// work counts what is under way by generation
+	work map[uint64]int
+}
+
+// start counts a piece of work, which reports back with done and the
+// generation returned
+func (d *drain) start() uint64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.work == nil {
+		d.work = make(map[uint64]int)
+	}
+	d.work[d.gen]++
+	return d.gen
+}
+
+// done counts a piece of work started in gen as finished
+func (d *drain) done(gen uint64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.work[gen]--; d.work[gen] <= 0 {
+		delete(d.work, gen)
+	}
+	if d.cond != nil {
+		d.cond.Broadcast()
+	}
+}
+
+// wait blocks until the work started before it is done
+func (d *drain) wait() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.cond == nil {
+		d.cond = sync.NewCond(&d.mu)
+	}
+	last := d.gen
+	d.gen++
+	for d.busy(last) {
+		d.cond.Wait()
+	}
+}
+
+// busy reports whether work started in last or before is under way
+func (d *drain) busy(last uint64) bool {
+	for gen := range d.work {
+		if gen <= last {
+			return true
+		}
+	}
+	return false
+}
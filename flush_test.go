@@ -0,0 +1,151 @@
+package zapcloudwatch
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"go.uber.org/zap/zapcore"
+)
+
+// hangSink blocks every put until release is closed
+type hangSink struct {
+	release chan struct{}
+}
+
+func (s hangSink) Put([]*cloudwatchlogs.InputLogEvent) error {
+	<-s.release
+	return nil
+}
+
+func TestCloseWithTimeout(t *testing.T) {
+	sink := hangSink{release: make(chan struct{})}
+	defer close(sink.release)
+	hook := &CloudwatchHook{Sink: sink, Async: true, BatchSize: 2, FlushInterval: time.Hour}
+	write, err := hook.GetHook()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the first batch hangs in flight and so does the third entry once
+	// closing flushes it
+	for _, msg := range []string{"one", "two", "three"} {
+		if err := write(zapcore.Entry{Level: zapcore.InfoLevel, Message: msg}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	start := time.Now()
+	if err := hook.CloseWithTimeout(50 * time.Millisecond); err != ErrCloseTimeout {
+		t.Fatalf("got %v, want ErrCloseTimeout", err)
+	}
+	if took := time.Since(start); took > time.Second {
+		t.Fatalf("close took %v despite the timeout", took)
+	}
+	if err := write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "late"}); err != ErrClosed {
+		t.Errorf("write after close = %v, want ErrClosed", err)
+	}
+}
+
+func TestCloseTimeoutField(t *testing.T) {
+	sink := hangSink{release: make(chan struct{})}
+	defer close(sink.release)
+	hook := &CloudwatchHook{Sink: sink, Async: true, CloseTimeout: 50 * time.Millisecond}
+	write, err := hook.GetHook()
+	if err != nil {
+		t.Fatal(err)
+	}
+	write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "stuck"})
+
+	if err := hook.Close(); err != ErrCloseTimeout {
+		t.Fatalf("got %v, want Close to honour CloseTimeout", err)
+	}
+}
+
+func TestCloseWithTimeoutDelivered(t *testing.T) {
+	sink := &memSink{}
+	hook := &CloudwatchHook{Sink: sink, Async: true, BatchSize: 10, FlushInterval: time.Hour}
+	write, err := hook.GetHook()
+	if err != nil {
+		t.Fatal(err)
+	}
+	write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "quick"})
+
+	if err := hook.CloseWithTimeout(time.Second); err != nil {
+		t.Fatalf("got %v, want a clean close", err)
+	}
+	if got := sink.messages(); len(got) != 1 {
+		t.Errorf("delivered %q, want the buffered entry", got)
+	}
+}
+
+func TestFlushWhileLoggingAsync(t *testing.T) {
+	sink := &memSink{}
+	hook := &CloudwatchHook{Sink: sink, Async: true}
+	write, err := hook.GetHook()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// writers keep sends in flight the whole time, so a flush waiting for
+	// none at all would never return
+	const writers, writes = 8, 200
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < writes; i++ {
+				write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "busy"})
+			}
+		}()
+	}
+	for i := 0; i < 20; i++ {
+		flushed := make(chan error, 1)
+		go func() { flushed <- hook.Flush() }()
+		select {
+		case err := <-flushed:
+			if err != nil {
+				t.Fatal(err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("flush didn't return while entries were being logged")
+		}
+	}
+	wg.Wait()
+
+	if err := hook.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(sink.messages()); n != writers*writes {
+		t.Errorf("delivered %d events, want %d", n, writers*writes)
+	}
+}
+
+func TestDrainWaitsForEarlierWork(t *testing.T) {
+	var d drain
+	before := d.start()
+
+	waited := make(chan struct{})
+	go func() {
+		d.wait()
+		close(waited)
+	}()
+	waitFor(t, "the wait to start", func() bool {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		return d.gen > before
+	})
+
+	// work started after the wait doesn't hold it up
+	after := d.start()
+	d.done(before)
+	select {
+	case <-waited:
+	case <-time.After(time.Second):
+		t.Fatal("wait blocked on work started after it")
+	}
+	d.done(after)
+	d.wait()
+}
@@ -0,0 +1,58 @@
+//go:build !windows
+
+package zapcloudwatch
+
+import (
+	"syscall"
+	"testing"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// SIGWINCH is ignored by default, so raising it again after the flush
+// leaves the test process alone
+func TestFlushOnSignal(t *testing.T) {
+	sink := &memSink{}
+	hook := &CloudwatchHook{Sink: sink, BatchSize: 100}
+	if _, err := hook.GetHook(); err != nil {
+		t.Fatal(err)
+	}
+	stop := hook.FlushOnSignal(syscall.SIGWINCH)
+	defer stop()
+
+	if err := hook.write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "buffered"}); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(sink.messages()); n != 0 {
+		t.Fatalf("%d events put before the signal", n)
+	}
+
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGWINCH); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the flush", func() bool { return len(sink.messages()) == 1 })
+	if err := hook.write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "late"}); err != ErrClosed {
+		t.Fatalf("write after the signal: got %v, want ErrClosed", err)
+	}
+}
+
+func TestFlushOnSignalStopped(t *testing.T) {
+	sink := &memSink{}
+	hook := &CloudwatchHook{Sink: sink, BatchSize: 100}
+	if _, err := hook.GetHook(); err != nil {
+		t.Fatal(err)
+	}
+	stop := hook.FlushOnSignal(syscall.SIGWINCH)
+	stop()
+	stop()
+
+	if err := hook.write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "buffered"}); err != nil {
+		t.Fatal(err)
+	}
+	syscall.Kill(syscall.Getpid(), syscall.SIGWINCH)
+	time.Sleep(50 * time.Millisecond)
+	if n := len(sink.messages()); n != 0 {
+		t.Fatalf("stopped handler flushed %d events", n)
+	}
+}
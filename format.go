@@ -0,0 +1,230 @@
+package zapcloudwatch
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// Format selects a built in way of serializing entries into event messages
+type Format int
+
+const (
+	// FormatText writes "[logger] message {fields}", the fields encoded as
+	// a JSON object.
+	FormatText Format = iota
+	// FormatJSON writes each entry as a JSON object holding its fields next
+	// to "level", "logger" and "msg". FieldOrder can put those first.
+	FormatJSON
+	// FormatLogfmt writes each entry as logfmt key=value pairs, starting
+	// with level, logger and msg.
+	FormatLogfmt
+)
+
+// LoggerNameFormat selects where FormatText entries carry their logger name
+type LoggerNameFormat int
+
+const (
+	// LoggerNamePrefix prefixes the message with the name, e.g. [payments].
+	LoggerNamePrefix LoggerNameFormat = iota
+	// LoggerNameField adds the name as the logger field instead, so Logs
+	// Insights can filter logger="payments".
+	LoggerNameField
+	// LoggerNameBoth does both.
+	LoggerNameBoth
+)
+
+// loggerKey is the key holding the logger name in structured output
+const loggerKey = "logger"
+
+// Serializer turns an entry and its fields, already converted to JSON
+// encodable values, into the message of an event.
+type Serializer interface {
+	Serialize(entry zapcore.Entry, fields map[string]interface{}) (string, error)
+}
+
+// textual reports whether entries are serialized as text, which leaves the
+// logger name and time to be prefixed when the event is made
+func (ch *CloudwatchHook) textual() bool {
+	return ch.Serializer == nil && ch.Format == FormatText
+}
+
+// withLogger returns fields followed by the logger field, if FormatText
+// entries carry their logger name as one. Other formats always hold it.
+func (ch *CloudwatchHook) withLogger(e zapcore.Entry, fields []zapcore.Field) []zapcore.Field {
+	if !ch.textual() || ch.LoggerName == LoggerNamePrefix || e.LoggerName == "" {
+		return fields
+	}
+	all := make([]zapcore.Field, 0, len(fields)+1)
+	all = append(all, fields...)
+	return append(all, zapcore.Field{Key: loggerKey, Type: zapcore.StringType, String: e.LoggerName})
+}
+
+// serialize turns an entry and its fields into the message of an event
+func (ch *CloudwatchHook) serialize(e zapcore.Entry, fields []zapcore.Field) (string, error) {
+	if ch.textual() && !ch.EventIDs {
+		return ch.formatMessage(e.Message, fields)
+	}
+
+	values := ch.fieldsWithMetadata(fields)
+	if ch.EventIDs {
+		values[eventIDKey] = ch.eventID(e, values)
+	}
+	if ch.textual() {
+		obj, err := ch.marshalObject(ch.nest(values), values)
+		if err != nil {
+			return "", err
+		}
+		return ch.joinMessage(e.Message, obj)
+	}
+	if ch.Serializer != nil {
+		return ch.Serializer.Serialize(e, values)
+	}
+	if ch.Format == FormatLogfmt {
+		return ch.serializeLogfmt(e, values), nil
+	}
+	return ch.serializeJSON(e, values)
+}
+
+// serializeJSON writes the entry as one JSON object. The entry's own keys
+// win over fields of the same name.
+func (ch *CloudwatchHook) serializeJSON(e zapcore.Entry, values map[string]interface{}) (string, error) {
+	obj := ch.nest(values)
+	obj["level"] = e.Level.String()
+	obj["msg"] = e.Message
+	if e.LoggerName != "" {
+		obj[loggerKey] = e.LoggerName
+	}
+
+	b, err := ch.marshalObject(obj, values)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// serializeLogfmt writes the entry as logfmt, fields in key order after
+// level, logger and msg. Nested values are encoded as quoted JSON.
+func (ch *CloudwatchHook) serializeLogfmt(e zapcore.Entry, values map[string]interface{}) string {
+	var b strings.Builder
+	b.WriteString("level=" + e.Level.String())
+	if e.LoggerName != "" {
+		b.WriteString(" logger=" + logfmtValue(e.LoggerName))
+	}
+	b.WriteString(" msg=" + logfmtValue(e.Message))
+
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		b.WriteString(" " + logfmtKey(k) + "=" + ch.logfmtAny(values[k]))
+	}
+	return b.String()
+}
+
+func (ch *CloudwatchHook) logfmtAny(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return logfmtValue(v)
+	case bool:
+		return strconv.FormatBool(v)
+	case int64, int, float64, uint64:
+		return fmt.Sprint(v)
+	}
+	b, err := ch.marshal(v)
+	if err != nil {
+		return logfmtValue(fmt.Sprint(v))
+	}
+	return logfmtValue(string(b))
+}
+
+// logfmtValue quotes s if it is empty or holds spaces, quotes, equals signs
+// or control characters
+func logfmtValue(s string) string {
+	if s == "" || strings.ContainsAny(s, " =\"\\") || strings.IndexFunc(s, isControl) >= 0 {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// logfmtKey replaces the characters a logfmt key can't hold
+func logfmtKey(k string) string {
+	return strings.Map(func(r rune) rune {
+		if r == ' ' || r == '=' || r == '"' || isControl(r) {
+			return '_'
+		}
+		return r
+	}, k)
+}
+
+func isControl(r rune) bool {
+	return r < ' ' || r == 0x7f
+}
+
+// appendFields adds string fields, given as keys and values, to a message
+// already serialized. In logfmt they are appended as pairs. A FormatJSON
+// message still whole after truncation is the object the hook encoded, which
+// they join; any other message gets them appended as an object of their own,
+// so text that happens to end in a brace is left alone.
+func (ch *CloudwatchHook) appendFields(msg string, keysAndValues ...string) string {
+	if ch.Serializer == nil && ch.Format == FormatLogfmt {
+		for i := 0; i+1 < len(keysAndValues); i += 2 {
+			msg += " " + logfmtKey(keysAndValues[i]) + "=" + logfmtValue(keysAndValues[i+1])
+		}
+		return msg
+	}
+
+	fields := make(map[string]string, len(keysAndValues)/2)
+	for i := 0; i+1 < len(keysAndValues); i += 2 {
+		fields[keysAndValues[i]] = keysAndValues[i+1]
+	}
+	// string values always encode
+	obj, _ := json.Marshal(fields)
+	if !ch.encodedObject(msg) {
+		return msg + " " + string(obj)
+	}
+	return joinEncoded(msg, string(obj[1:len(obj)-1]))
+}
+
+// joinEncoded adds members to the JSON object msg holds
+func joinEncoded(msg, members string) string {
+	head := strings.TrimRight(msg[:len(msg)-1], " \t\r\n")
+	if strings.HasSuffix(head, "{") {
+		return head + members + "}"
+	}
+	return head + "," + members + "}"
+}
+
+// encodedObject reports whether msg is the JSON object FormatJSON encoded an
+// entry into, rather than text or an object cut short by MaxMessageLength
+func (ch *CloudwatchHook) encodedObject(msg string) bool {
+	return ch.Serializer == nil && ch.Format == FormatJSON &&
+		strings.HasPrefix(msg, "{") && strings.HasSuffix(msg, "}") && json.Valid([]byte(msg))
+}
+
+// eventIDKey is the field holding the id EventIDs adds
+const eventIDKey = "event_id"
+
+// eventID hashes the entry's time, level, logger name, message and fields.
+// Fields are encoded with sorted keys, so the same entry always gets the
+// same id.
+func (ch *CloudwatchHook) eventID(e zapcore.Entry, values map[string]interface{}) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%d\x00%s\x00%s\x00%s\x00", e.Time.UnixNano(), e.Level, e.LoggerName, e.Message)
+	if b, err := ch.marshal(values); err == nil {
+		h.Write(b)
+	} else {
+		fmt.Fprint(h, values)
+	}
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
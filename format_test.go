@@ -0,0 +1,222 @@
+package zapcloudwatch
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// serialized returns the message the hook makes of an entry and its fields
+func serialized(t *testing.T, ch *CloudwatchHook, e zapcore.Entry, fields ...zapcore.Field) string {
+	t.Helper()
+	msg, err := ch.serialize(e, fields)
+	if err != nil {
+		t.Fatalf("serializing %v: %v", fields, err)
+	}
+	return msg
+}
+
+func TestFieldsKeyNestsLevel(t *testing.T) {
+	entry := zapcore.Entry{Level: zapcore.ErrorLevel, Message: "failed"}
+	tests := []struct {
+		format Format
+		want   string
+	}{
+		{FormatJSON, `{"fields":{"level":"shadow","msg":"x"},"level":"error","msg":"failed"}`},
+		{FormatText, `failed {"fields":{"level":"shadow","msg":"x"}}`},
+	}
+	for _, tt := range tests {
+		ch := &CloudwatchHook{Format: tt.format, FieldsKey: "fields"}
+		if got := serialized(t, ch, entry, zap.String("level", "shadow"), zap.String("msg", "x")); got != tt.want {
+			t.Errorf("format %d: got %s, want %s", tt.format, got, tt.want)
+		}
+	}
+}
+
+func TestFieldsSeparator(t *testing.T) {
+	entry := zapcore.Entry{Level: zapcore.InfoLevel, Message: "sent"}
+	tests := []struct {
+		sep  string
+		want string
+	}{
+		{"", `sent {"n":1}`},
+		{"\t", "sent\t{\"n\":1}"},
+		{" ||| ", `sent ||| {"n":1}`},
+	}
+	for _, tt := range tests {
+		ch := &CloudwatchHook{FieldsSeparator: tt.sep}
+		if got := serialized(t, ch, entry, zap.Int("n", 1)); got != tt.want {
+			t.Errorf("separator %q: got %q, want %q", tt.sep, got, tt.want)
+		}
+	}
+}
+
+func TestFormats(t *testing.T) {
+	entry := zapcore.Entry{Level: zapcore.WarnLevel, LoggerName: "billing", Message: "card declined"}
+	fields := []zapcore.Field{zap.String("reason", "expired card"), zap.Int("amount", 42), zap.Strings("tags", []string{"eu"}), zap.Bool("retry", false)}
+	tests := []struct {
+		format Format
+		want   string
+	}{
+		{FormatJSON, `{"amount":42,"level":"warn","logger":"billing","msg":"card declined","reason":"expired card","retry":false,"tags":["eu"]}`},
+		{FormatLogfmt, `level=warn logger=billing msg="card declined" amount=42 reason="expired card" retry=false tags="[\"eu\"]"`},
+	}
+	for _, tt := range tests {
+		ch := &CloudwatchHook{Format: tt.format}
+		if got := serialized(t, ch, entry, fields...); got != tt.want {
+			t.Errorf("format %d:\ngot  %s\nwant %s", tt.format, got, tt.want)
+		}
+	}
+}
+
+func TestFormatThroughCore(t *testing.T) {
+	tests := []struct {
+		format Format
+		want   string
+	}{
+		{FormatJSON, `{"level":"info","logger":"api","msg":"served","path":"/v1","status":200}`},
+		{FormatLogfmt, `level=info logger=api msg=served path=/v1 status=200`},
+	}
+	for _, tt := range tests {
+		sink := &memSink{}
+		hook := &CloudwatchHook{Sink: sink, Format: tt.format}
+		core, err := hook.GetCore(zapcore.DebugLevel)
+		if err != nil {
+			t.Fatal(err)
+		}
+		zap.New(core).Named("api").With(zap.String("path", "/v1")).Info("served", zap.Int("status", 200))
+		hook.Close()
+
+		if got := sink.messages(); len(got) != 1 || got[0] != tt.want {
+			t.Errorf("format %d: got %q, want %s", tt.format, got, tt.want)
+		}
+	}
+}
+
+func TestLogfmtQuoting(t *testing.T) {
+	entry := zapcore.Entry{Level: zapcore.InfoLevel, Message: "m"}
+	ch := &CloudwatchHook{Format: FormatLogfmt}
+	got := serialized(t, ch, entry, zap.String("empty", ""), zap.String("eq", "a=b"), zap.String("nl", "a\nb"), zap.String("bad key", "v"))
+	want := `level=info msg=m bad_key=v empty="" eq="a=b" nl="a\nb"`
+	if got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
+
+func TestAppendFields(t *testing.T) {
+	tests := []struct {
+		name   string
+		format Format
+		msg    string
+		want   string
+	}{
+		{"text", FormatText, `[] hi {"a":1}`, `[] hi {"a":1} {"id":"x\u0000y"}`},
+		{"text ending in a brace", FormatText, `[] got {x}`, `[] got {x} {"id":"x\u0000y"}`},
+		{"json", FormatJSON, `{"level":"info","msg":"hi"}`, `{"level":"info","msg":"hi","id":"x\u0000y"}`},
+		{"truncated json", FormatJSON, `{"level":"info","msg":"h…`, `{"level":"info","msg":"h… {"id":"x\u0000y"}`},
+		{"json text", FormatJSON, `{"a":}`, `{"a":} {"id":"x\u0000y"}`},
+		{"logfmt", FormatLogfmt, `level=info msg=hi`, `level=info msg=hi id="x\x00y"`},
+	}
+	for _, tt := range tests {
+		ch := &CloudwatchHook{Format: tt.format}
+		if got := ch.appendFields(tt.msg, "id", "x\x00y"); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestEventIDStable(t *testing.T) {
+	ch := &CloudwatchHook{Format: FormatJSON, EventIDs: true}
+	at := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	id := func(e zapcore.Entry, fields ...zapcore.Field) string {
+		t.Helper()
+		var obj map[string]interface{}
+		if err := json.Unmarshal([]byte(serialized(t, ch, e, fields...)), &obj); err != nil {
+			t.Fatal(err)
+		}
+		id, _ := obj[eventIDKey].(string)
+		if len(id) != 32 {
+			t.Fatalf("got event id %q, want 32 hex digits", id)
+		}
+		return id
+	}
+
+	entry := zapcore.Entry{Time: at, Level: zapcore.InfoLevel, LoggerName: "api", Message: "served"}
+	first := id(entry, zap.Int("status", 200), zap.String("path", "/v1"))
+	// the same entry, with its fields in another order
+	if again := id(entry, zap.String("path", "/v1"), zap.Int("status", 200)); again != first {
+		t.Errorf("identical entries got ids %s and %s", first, again)
+	}
+
+	changed := []zapcore.Entry{entry, entry, entry}
+	changed[0].Time = at.Add(time.Nanosecond)
+	changed[1].Level = zapcore.WarnLevel
+	changed[2].Message = "failed"
+	for _, e := range changed {
+		if other := id(e, zap.Int("status", 200), zap.String("path", "/v1")); other == first {
+			t.Errorf("%+v got the id of the original entry", e)
+		}
+	}
+	if other := id(entry, zap.Int("status", 500), zap.String("path", "/v1")); other == first {
+		t.Error("different fields got the same id")
+	}
+}
+
+func TestIndexedFields(t *testing.T) {
+	entry := zapcore.Entry{Level: zapcore.InfoLevel, Message: "served"}
+	fields := []zapcore.Field{zap.String("request_id", "r1"), zap.String("req_path", "/v1"), zap.Int("bytes", 512), zap.String("body", "…")}
+	tests := []struct {
+		name    string
+		format  Format
+		indexed []string
+		want    string
+	}{
+		{"text", FormatText, []string{"request_id"}, `served {"details":{"body":"…","bytes":512,"req_path":"/v1"},"request_id":"r1"}`},
+		{"pattern", FormatText, []string{"req*", "bytes"}, `served {"bytes":512,"details":{"body":"…"},"req_path":"/v1","request_id":"r1"}`},
+		{"json", FormatJSON, []string{"request_id"}, `{"details":{"body":"…","bytes":512,"req_path":"/v1"},"level":"info","msg":"served","request_id":"r1"}`},
+		{"none", FormatText, nil, `served {"details":{"body":"…","bytes":512,"req_path":"/v1","request_id":"r1"}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ch := &CloudwatchHook{Format: tt.format, FieldsKey: "details", IndexedFields: tt.indexed}
+			if got := serialized(t, ch, entry, fields...); got != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoggerNameFormat(t *testing.T) {
+	tests := []struct {
+		format LoggerNameFormat
+		want   string
+	}{
+		{LoggerNamePrefix, `[api.db] slow {"ms":900}`},
+		{LoggerNameField, `slow {"logger":"api.db","ms":900}`},
+		{LoggerNameBoth, `[api.db] slow {"logger":"api.db","ms":900}`},
+	}
+	for _, tt := range tests {
+		sink := &memSink{}
+		hook := &CloudwatchHook{Sink: sink, LoggerName: tt.format}
+		core, err := hook.GetCore(zapcore.DebugLevel)
+		if err != nil {
+			t.Fatal(err)
+		}
+		logger := zap.New(core)
+		logger.Named("api").Named("db").Warn("slow", zap.Int("ms", 900))
+		// entries without a logger name get no logger field, and an empty prefix
+		logger.Info("plain")
+		hook.Close()
+
+		want := []string{tt.want, "plain {}"}
+		if tt.format != LoggerNameField {
+			want[1] = "[] plain {}"
+		}
+		if got := sink.messages(); len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+			t.Errorf("format %d: got %q, want %q", tt.format, got, want)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package zapcloudwatch
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+)
+
+// hashKey and prevHashKey are the fields ContentHash adds
+const (
+	hashKey     = "hash"
+	prevHashKey = "prev_hash"
+)
+
+// hashChain is the hash of the last event a hook put, which the next one's
+// covers with HashChain
+type hashChain struct {
+	// mu is held from hashing events until their put is done, so the chain
+	// follows the order of puts
+	mu   sync.Mutex
+	last string
+}
+
+// putHashed sorts events as a put does, adds the ContentHash fields to
+// copies of them and puts those as putTagged does, returning what was put.
+// With HashChain the chain only moves on once the put succeeded, so it
+// covers exactly the events delivered.
+func (ch *CloudwatchHook) putHashed(events []*cloudwatchlogs.InputLogEvent) ([]*cloudwatchlogs.InputLogEvent, error) {
+	if ch.HashChain {
+		ch.chain.mu.Lock()
+		defer ch.chain.mu.Unlock()
+	}
+
+	prev := ch.chain.last
+	hashed := make([]*cloudwatchlogs.InputLogEvent, 0, len(events))
+	for _, event := range chronological(events) {
+		var msg string
+		msg, prev = ch.addHash(aws.StringValue(event.Message), prev)
+		hashed = append(hashed, &cloudwatchlogs.InputLogEvent{Message: aws.String(msg), Timestamp: event.Timestamp})
+	}
+	put, err := ch.putTagged(hashed)
+	if err == nil && ch.HashChain {
+		ch.chain.last = prev
+	}
+	return put, err
+}
+
+// addHash adds the ContentHash fields to an event message, returning it and
+// its hash. To verify an event, hash its message as it was before them,
+// preceded with HashChain by prev_hash, and compare the result with hash.
+func (ch *CloudwatchHook) addHash(msg, prev string) (string, string) {
+	h := ch.newHash()
+	if !ch.HashChain {
+		h.Write([]byte(msg))
+		sum := hex.EncodeToString(h.Sum(nil))
+		return ch.appendFields(msg, hashKey, sum), sum
+	}
+
+	h.Write([]byte(prev))
+	h.Write([]byte(msg))
+	sum := hex.EncodeToString(h.Sum(nil))
+	return ch.appendFields(msg, hashKey, sum, prevHashKey, prev), sum
+}
+
+// newHash returns the hash ContentHash uses
+func (ch *CloudwatchHook) newHash() hash.Hash {
+	if ch.ContentHashFunc != nil {
+		return ch.ContentHashFunc()
+	}
+	return sha256.New()
+}
+
+// hashRoom is the most bytes addHash adds to a message, which
+// MaxMessageLength leaves room for
+func (ch *CloudwatchHook) hashRoom() int {
+	sum := strings.Repeat("0", hex.EncodedLen(ch.newHash().Size()))
+	msg := ch.appendFields("", hashKey, sum)
+	if ch.HashChain {
+		msg = ch.appendFields("", hashKey, sum, prevHashKey, sum)
+	}
+	return len(msg)
+}
@@ -0,0 +1,183 @@
+package zapcloudwatch
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// splitHash splits an event message into the message that was hashed and the
+// hash fields added to it
+func splitHash(t *testing.T, msg string) (string, map[string]string) {
+	t.Helper()
+	i := strings.LastIndex(msg, " {")
+	if i < 0 {
+		t.Fatalf("no hash fields in %q", msg)
+	}
+	var fields map[string]string
+	if err := json.Unmarshal([]byte(msg[i+1:]), &fields); err != nil {
+		t.Fatalf("hash fields of %q: %v", msg, err)
+	}
+	return msg[:i], fields
+}
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestContentHash(t *testing.T) {
+	sink := &memSink{}
+	hook := &CloudwatchHook{Sink: sink, ContentHash: true}
+	hook.AddMessage(zapcore.InfoLevel, "one")
+	hook.AddMessage(zapcore.InfoLevel, "two")
+	hook.Close()
+
+	got := sink.messages()
+	if len(got) != 2 {
+		t.Fatalf("got %q", got)
+	}
+	for _, msg := range got {
+		hashed, fields := splitHash(t, msg)
+		if fields[hashKey] != sha256Hex(hashed) {
+			t.Errorf("%q: hash %s, want %s", msg, fields[hashKey], sha256Hex(hashed))
+		}
+		if _, ok := fields[prevHashKey]; ok {
+			t.Errorf("%q: has a prev_hash without HashChain", msg)
+		}
+	}
+}
+
+func TestHashChain(t *testing.T) {
+	sink := &memSink{}
+	hook := &CloudwatchHook{Sink: sink, ContentHash: true, HashChain: true}
+	for _, msg := range []string{"one", "two", "three"} {
+		hook.AddMessage(zapcore.InfoLevel, msg)
+	}
+	hook.Close()
+
+	got := sink.messages()
+	if len(got) != 3 {
+		t.Fatalf("got %q", got)
+	}
+	prev := ""
+	for _, msg := range got {
+		hashed, fields := splitHash(t, msg)
+		if fields[prevHashKey] != prev {
+			t.Errorf("%q: prev_hash %q, want %q", msg, fields[prevHashKey], prev)
+		}
+		if want := sha256Hex(prev + hashed); fields[hashKey] != want {
+			t.Errorf("%q: hash %s, want %s", msg, fields[hashKey], want)
+		}
+		prev = fields[hashKey]
+	}
+}
+
+func TestHashChainAsync(t *testing.T) {
+	sink := &memSink{}
+	hook := &CloudwatchHook{Sink: sink, ContentHash: true, HashChain: true, Async: true, BatchSize: 4,
+		CoalesceWindow: time.Hour, CoalesceIgnoreFields: true}
+	core, err := hook.GetCore(zapcore.DebugLevel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := zap.New(core)
+
+	// batches go out concurrently and entries of one writer coalesce when
+	// no other gets between them, yet the chain must follow the puts
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				logger.Info(fmt.Sprint("writer ", w), zap.Int("i", i))
+			}
+		}(w)
+	}
+	wg.Wait()
+	if err := hook.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	got := sink.messages()
+	if len(got) == 0 {
+		t.Fatal("nothing put")
+	}
+	prev := ""
+	for _, msg := range got {
+		hashed, fields := splitHash(t, msg)
+		if fields[prevHashKey] != prev {
+			t.Fatalf("%q: prev_hash %q, want %q", msg, fields[prevHashKey], prev)
+		}
+		if want := sha256Hex(prev + hashed); fields[hashKey] != want {
+			t.Fatalf("%q: hash %s, want %s", msg, fields[hashKey], want)
+		}
+		prev = fields[hashKey]
+	}
+}
+
+func TestHashChainSkipsFailedPuts(t *testing.T) {
+	sink := &memSink{}
+	hook := &CloudwatchHook{Sink: sink, ContentHash: true, HashChain: true}
+	hook.AddMessage(zapcore.InfoLevel, "one")
+	sink.fail(errors.New("unavailable"))
+	hook.AddMessage(zapcore.InfoLevel, "lost")
+	sink.fail(nil)
+	hook.AddMessage(zapcore.InfoLevel, "two")
+	hook.Close()
+
+	got := sink.messages()
+	if len(got) != 2 {
+		t.Fatalf("got %q", got)
+	}
+	_, first := splitHash(t, got[0])
+	if _, second := splitHash(t, got[1]); second[prevHashKey] != first[hashKey] {
+		t.Errorf("prev_hash %q, want the hash of the event put before, %q", second[prevHashKey], first[hashKey])
+	}
+}
+
+func TestContentHashMaxMessageLength(t *testing.T) {
+	tests := []struct {
+		name  string
+		chain bool
+		max   int
+	}{
+		{"hash", false, 100},
+		{"chain", true, 200},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := &memSink{}
+			hook := &CloudwatchHook{Sink: sink, ContentHash: true, HashChain: tt.chain,
+				MaxMessageLength: tt.max, TruncationSuffix: "..."}
+			hook.AddMessage(zapcore.InfoLevel, strings.Repeat("a", 300))
+			hook.AddMessage(zapcore.InfoLevel, "short")
+			hook.Close()
+
+			got := sink.messages()
+			if len(got) != 2 {
+				t.Fatalf("got %q", got)
+			}
+			for _, msg := range got {
+				if len(msg) > tt.max {
+					t.Errorf("%d byte message, over the %d limit: %q", len(msg), tt.max, msg)
+				}
+				// the hash still covers what was left of the message
+				hashed, fields := splitHash(t, msg)
+				if want := sha256Hex(fields[prevHashKey] + hashed); fields[hashKey] != want {
+					t.Errorf("%q: hash %s, want %s", msg, fields[hashKey], want)
+				}
+			}
+		})
+	}
+}
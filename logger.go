@@ -0,0 +1,122 @@
+package zapcloudwatch
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Option configures the logger built by NewLogger
+type Option func(*loggerConfig)
+
+type loggerConfig struct {
+	hook    *CloudwatchHook
+	level   zapcore.Level
+	tee     []zapcore.Core
+	zapOpts []zap.Option
+	// err is the first error of an option, returned by NewLogger
+	err error
+}
+
+// WithAWSConfig sets the AWS config the cloudwatch client is built from
+func WithAWSConfig(cfg *aws.Config) Option {
+	return func(c *loggerConfig) {
+		c.hook.AWSConfig = cfg
+	}
+}
+
+// WithLevel sets the minimum level sent to cloudwatch. Defaults to info.
+func WithLevel(level zapcore.Level) Option {
+	return func(c *loggerConfig) {
+		c.level = level
+	}
+}
+
+// WithLevels sets the levels sent to cloudwatch from a comma separated list
+// of names, e.g. "info,error,fatal" taken from an environment variable. See
+// ParseLevels.
+func WithLevels(s string) Option {
+	return func(c *loggerConfig) {
+		levels, err := ParseLevels(s)
+		if err != nil {
+			if c.err == nil {
+				c.err = err
+			}
+			return
+		}
+		c.hook.AcceptedLevels = levels
+		for i, level := range levels {
+			if i == 0 || level < c.level {
+				c.level = level
+			}
+		}
+	}
+}
+
+// WithAsync sends events in the background
+func WithAsync() Option {
+	return func(c *loggerConfig) {
+		c.hook.Async = true
+	}
+}
+
+// WithTee also writes every entry to the given cores, e.g. a console core
+func WithTee(cores ...zapcore.Core) Option {
+	return func(c *loggerConfig) {
+		c.tee = append(c.tee, cores...)
+	}
+}
+
+// WithZapOptions passes options on to zap.New
+func WithZapOptions(opts ...zap.Option) Option {
+	return func(c *loggerConfig) {
+		c.zapOpts = append(c.zapOpts, opts...)
+	}
+}
+
+// Configure changes any other setting of the underlying hook
+func Configure(fn func(*CloudwatchHook)) Option {
+	return func(c *loggerConfig) {
+		fn(c.hook)
+	}
+}
+
+// NewLogger builds a logger that sends entries to the given log group and
+// stream. The returned function flushes and closes the hook and should be
+// called before the program exits.
+//
+//	logger, closeLogs, err := zapcloudwatch.NewLogger("xyz", "xyz1", zapcloudwatch.WithAWSConfig(cfg))
+//	if err != nil {
+//		panic(err)
+//	}
+//	defer closeLogs()
+func NewLogger(groupName, streamName string, opts ...Option) (*zap.Logger, func() error, error) {
+	c := &loggerConfig{
+		hook:  &CloudwatchHook{GroupName: groupName, StreamName: streamName},
+		level: zapcore.InfoLevel,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.err != nil {
+		return nil, nil, c.err
+	}
+	if c.hook.AcceptedLevels == nil {
+		c.hook.AcceptedLevels = LevelThreshold(c.level)
+	}
+
+	core, err := c.hook.GetCore(c.level)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(c.tee) > 0 {
+		core = zapcore.NewTee(append(c.tee, core)...)
+	}
+
+	logger := zap.New(core, c.zapOpts...)
+	closer := func() error {
+		logger.Sync()
+		return c.hook.Close()
+	}
+	return logger, closer, nil
+}
@@ -0,0 +1,91 @@
+package zapcloudwatch
+
+import (
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs/cloudwatchlogsiface"
+)
+
+// HookManager hands out hooks that share a single cloudwatch client. Asking
+// twice for the same group and stream returns the same hook, so modules
+// logging there share its buffer and sequence token too.
+type HookManager struct {
+	// Client is shared by every hook. If nil, one is built from AWSConfig
+	// the first time a hook is asked for.
+	Client    cloudwatchlogsiface.CloudWatchLogsAPI
+	AWSConfig *aws.Config
+	// Configure, if set, is applied to every new hook, e.g. to set its
+	// levels or batching.
+	Configure func(*CloudwatchHook)
+
+	mu    sync.Mutex
+	hooks map[destination]*CloudwatchHook
+}
+
+// NewHookManager creates a manager whose hooks share a client built from cfg
+func NewHookManager(cfg *aws.Config) *HookManager {
+	return &HookManager{AWSConfig: cfg}
+}
+
+// Hook returns the hook for group and stream, creating it on first use
+func (m *HookManager) Hook(group, stream string) *CloudwatchHook {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dest := destination{group: group, stream: stream}
+	if ch, ok := m.hooks[dest]; ok {
+		return ch
+	}
+
+	if m.Client == nil {
+		// if the client can't be built, each hook tries again and reports
+		// why on setup
+		if client, err := newClient(m.AWSConfig); err == nil {
+			m.Client = client
+		}
+	}
+	ch := &CloudwatchHook{GroupName: group, StreamName: stream, Client: m.Client, AWSConfig: m.AWSConfig}
+	if m.Configure != nil {
+		m.Configure(ch)
+	}
+
+	if m.hooks == nil {
+		m.hooks = make(map[destination]*CloudwatchHook)
+	}
+	m.hooks[dest] = ch
+	return ch
+}
+
+// Flush flushes every hook handed out so far and returns the first error
+func (m *HookManager) Flush() error {
+	var err error
+	for _, ch := range m.all() {
+		if ferr := ch.Flush(); err == nil {
+			err = ferr
+		}
+	}
+	return err
+}
+
+// Close closes every hook handed out so far and returns the first error
+func (m *HookManager) Close() error {
+	var err error
+	for _, ch := range m.all() {
+		if cerr := ch.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+func (m *HookManager) all() []*CloudwatchHook {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	hooks := make([]*CloudwatchHook, 0, len(m.hooks))
+	for _, ch := range m.hooks {
+		hooks = append(hooks, ch)
+	}
+	return hooks
+}
@@ -0,0 +1,43 @@
+package zapcloudwatch
+
+import (
+	"testing"
+
+	"go.uber.org/zap/zapcore"
+)
+
+func TestHookManagerSharesClient(t *testing.T) {
+	srv := logsServer(t, nil)
+	m := NewHookManager(serverConfig(srv))
+	m.Configure = func(ch *CloudwatchHook) { ch.BatchSize = 10 }
+
+	web, worker := m.Hook("group", "web"), m.Hook("group", "worker")
+	if web.Client == nil || web.Client != worker.Client {
+		t.Fatalf("hooks got clients %p and %p, want one shared client", web.Client, worker.Client)
+	}
+	if again := m.Hook("group", "web"); again != web {
+		t.Error("asking again for a stream gave a new hook")
+	}
+	if web.BatchSize != 10 || worker.BatchSize != 10 {
+		t.Error("Configure wasn't applied to every hook")
+	}
+}
+
+func TestHookManagerFlushesAll(t *testing.T) {
+	logs := &mockLogs{}
+	m := &HookManager{Client: logs, Configure: func(ch *CloudwatchHook) { ch.BatchSize = 10 }}
+	m.Hook("group", "web").AddMessage(zapcore.InfoLevel, "served")
+	m.Hook("group", "worker").AddMessage(zapcore.InfoLevel, "processed")
+	if n := logs.count("PutLogEvents"); n != 0 {
+		t.Fatalf("made %d puts before flushing", n)
+	}
+
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	checkMessages(t, logs, "group", "web", "[] served")
+	checkMessages(t, logs, "group", "worker", "[] processed")
+	if n := logs.count("CreateLogGroup"); n != 1 {
+		t.Errorf("created the group %d times, want once", n)
+	}
+}
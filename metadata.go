@@ -0,0 +1,122 @@
+package zapcloudwatch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/ec2metadata"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+const metadataTimeout = 2 * time.Second
+
+// sourceKey is the field holding SourceTag
+const sourceKey = "source"
+
+// ecsContainerMetadata and ecsTaskMetadata are the parts of the ECS task
+// metadata endpoint v4 responses that get attached to events
+type ecsContainerMetadata struct {
+	DockerId string
+}
+
+type ecsTaskMetadata struct {
+	Cluster          string
+	TaskARN          string
+	AvailabilityZone string
+}
+
+// loadMetadata looks up the ECS task or EC2 instance the process runs on, once.
+// Without either endpoint nothing is attached and the problem goes to OnError.
+func (ch *CloudwatchHook) loadMetadata(ctx context.Context) {
+	if !ch.ResourceMetadata {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, metadataTimeout)
+	defer cancel()
+
+	uri := ch.ECSMetadataURI
+	if uri == "" {
+		uri = os.Getenv("ECS_CONTAINER_METADATA_URI_V4")
+	}
+
+	var err error
+	if uri != "" {
+		ch.metadata, err = fetchECSMetadata(ctx, strings.TrimSuffix(uri, "/"))
+	} else {
+		ch.metadata, err = ch.fetchEC2Metadata(ctx)
+	}
+	if err != nil {
+		ch.reportError(fmt.Errorf("zapcloudwatch: resource metadata unavailable: %w", err))
+	}
+}
+
+func fetchECSMetadata(ctx context.Context, uri string) (map[string]string, error) {
+	var container ecsContainerMetadata
+	if err := getJSON(ctx, uri, &container); err != nil {
+		return nil, err
+	}
+	var task ecsTaskMetadata
+	if err := getJSON(ctx, uri+"/task", &task); err != nil {
+		return nil, err
+	}
+
+	md := make(map[string]string)
+	addMetadata(md, "container_id", container.DockerId)
+	addMetadata(md, "ecs_cluster", task.Cluster)
+	addMetadata(md, "ecs_task_arn", task.TaskARN)
+	addMetadata(md, "availability_zone", task.AvailabilityZone)
+	return md, nil
+}
+
+func (ch *CloudwatchHook) fetchEC2Metadata(ctx context.Context) (map[string]string, error) {
+	// AWSConfig's endpoint is that of cloudwatch, not of the metadata service
+	cfg := ch.AWSConfig.Copy()
+	cfg.Endpoint = nil
+	if ch.IMDSEndpoint != "" {
+		cfg.Endpoint = aws.String(ch.IMDSEndpoint)
+	}
+	sess, err := session.NewSession(cfg)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := ec2metadata.New(sess).GetInstanceIdentityDocumentWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	md := make(map[string]string)
+	addMetadata(md, "ec2_instance_id", doc.InstanceID)
+	addMetadata(md, "ec2_instance_type", doc.InstanceType)
+	addMetadata(md, "availability_zone", doc.AvailabilityZone)
+	return md, nil
+}
+
+func addMetadata(md map[string]string, key, value string) {
+	if value != "" {
+		md[key] = value
+	}
+}
+
+func getJSON(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
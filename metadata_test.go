@@ -0,0 +1,131 @@
+package zapcloudwatch
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// metadataEvent logs one entry through a hook with ResourceMetadata set and
+// returns the event sent
+func metadataEvent(t *testing.T, hook *CloudwatchHook) string {
+	t.Helper()
+	sink := &memSink{}
+	hook.Sink = sink
+	hook.ResourceMetadata = true
+	core, err := hook.GetCore(zapcore.DebugLevel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zap.New(core).Info("hello")
+	hook.Close()
+
+	msgs := sink.messages()
+	if len(msgs) != 1 {
+		t.Fatalf("got %q, want one event", msgs)
+	}
+	return msgs[0]
+}
+
+func TestECSMetadata(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v4":
+			w.Write([]byte(`{"DockerId":"c0ffee","Name":"web"}`))
+		case "/v4/task":
+			w.Write([]byte(`{"Cluster":"prod","TaskARN":"arn:aws:ecs:us-east-1:1:task/prod/abc","AvailabilityZone":"us-east-1a"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	got := metadataEvent(t, &CloudwatchHook{ECSMetadataURI: srv.URL + "/v4/"})
+	want := `[] hello {"availability_zone":"us-east-1a","container_id":"c0ffee","ecs_cluster":"prod","ecs_task_arn":"arn:aws:ecs:us-east-1:1:task/prod/abc"}`
+	if got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+// imdsServer is an EC2 instance metadata endpoint serving the identity
+// document of an instance
+func imdsServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPut && r.URL.Path == "/latest/api/token":
+			w.Header().Set("X-Aws-Ec2-Metadata-Token-Ttl-Seconds", r.Header.Get("X-Aws-Ec2-Metadata-Token-Ttl-Seconds"))
+			w.Write([]byte("imds-token"))
+		case r.URL.Path == "/latest/dynamic/instance-identity/document":
+			if r.Header.Get("X-Aws-Ec2-Metadata-Token") != "imds-token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`{"instanceId":"i-123","instanceType":"t3.micro","availabilityZone":"eu-west-1b","region":"eu-west-1"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestEC2Metadata(t *testing.T) {
+	t.Setenv("ECS_CONTAINER_METADATA_URI_V4", "")
+	srv := imdsServer()
+	defer srv.Close()
+
+	got := metadataEvent(t, &CloudwatchHook{IMDSEndpoint: srv.URL})
+	want := `[] hello {"availability_zone":"eu-west-1b","ec2_instance_id":"i-123","ec2_instance_type":"t3.micro"}`
+	if got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+// countingTransport counts the requests it passes on
+type countingTransport struct {
+	requests atomic.Int32
+}
+
+func (c *countingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	c.requests.Add(1)
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestEC2MetadataAWSConfig(t *testing.T) {
+	t.Setenv("ECS_CONTAINER_METADATA_URI_V4", "")
+	// a CA bundle can't be applied to the custom transport
+	t.Setenv("AWS_CA_BUNDLE", "")
+	srv := imdsServer()
+	defer srv.Close()
+
+	// the lookup goes through AWSConfig's client but not to its endpoint
+	transport := &countingTransport{}
+	got := metadataEvent(t, &CloudwatchHook{IMDSEndpoint: srv.URL, AWSConfig: &aws.Config{
+		Endpoint:   aws.String("http://logs.invalid"),
+		HTTPClient: &http.Client{Transport: transport},
+	}})
+	if want := `[] hello {"availability_zone":"eu-west-1b","ec2_instance_id":"i-123","ec2_instance_type":"t3.micro"}`; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	if transport.requests.Load() == 0 {
+		t.Error("the lookup didn't use AWSConfig's HTTP client")
+	}
+}
+
+func TestMetadataUnavailable(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	var errs []error
+	got := metadataEvent(t, &CloudwatchHook{ECSMetadataURI: srv.URL, OnError: func(err error) { errs = append(errs, err) }})
+	if got != "[] hello {}" {
+		t.Errorf("got %s, want no metadata", got)
+	}
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "resource metadata unavailable") {
+		t.Errorf("OnError got %v, want the unavailable endpoint reported", errs)
+	}
+}
@@ -0,0 +1,244 @@
+package zapcloudwatch
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/cloudwatch/cloudwatchiface"
+	"go.uber.org/zap/zapcore"
+)
+
+// maxMetricData is the most metric data a single PutMetricData call takes
+const maxMetricData = 1000
+
+// MetricField describes the metric published for a numeric field
+type MetricField struct {
+	// Name is the metric name. Defaults to the field key.
+	Name string
+	// Unit is one of the cloudwatch.StandardUnit values. Duration fields
+	// are converted to it if it is a time unit, and sent in seconds
+	// otherwise.
+	Unit string
+	// Dimensions are added to every datum as they are.
+	Dimensions map[string]string
+	// DimensionFields lists the keys of string fields logged along with the
+	// entry whose values become dimensions of the same name.
+	DimensionFields []string
+}
+
+// MetricsEmitter publishes numeric fields of the entries a hook sends as
+// CloudWatch metrics, next to the log events themselves.
+//
+//	hook.Metrics = &zapcloudwatch.MetricsEmitter{
+//		Namespace: "myapp",
+//		Fields: map[string]zapcloudwatch.MetricField{
+//			"latency": {Name: "RequestLatency", Unit: cloudwatch.StandardUnitMilliseconds},
+//		},
+//	}
+type MetricsEmitter struct {
+	// Client puts the metric data. If nil, one is built from the hook's AWS
+	// config when the hook is set up.
+	Client cloudwatchiface.CloudWatchAPI
+	// Namespace is the namespace of every metric.
+	Namespace string
+	// Fields maps the keys of fields published as metrics to their metric.
+	Fields map[string]MetricField
+	// FlushInterval, if positive, buffers metric data and puts it at most
+	// this long after the first datum, in calls of up to 1000 data.
+	// Otherwise every entry's data is put as it is written, in the
+	// background if the hook is Async.
+	FlushInterval time.Duration
+
+	mu    sync.Mutex
+	buf   []*cloudwatch.MetricDatum
+	timer *time.Timer
+	// onError is told about failed puts
+	onError func(error)
+	// async puts unbuffered data in the background, as the hook's own
+	// events are
+	async   bool
+	pending drain
+}
+
+// observe publishes the metrics among the fields of an entry, nothing if m
+// is nil
+func (m *MetricsEmitter) observe(e zapcore.Entry, fields ...[]zapcore.Field) {
+	if m == nil || len(m.Fields) == 0 {
+		return
+	}
+
+	dims := make(map[string]string)
+	var data []*cloudwatch.MetricDatum
+	for _, fs := range fields {
+		for _, field := range fs {
+			if field.Type == zapcore.StringType {
+				dims[field.Key] = field.String
+			}
+		}
+	}
+	for _, fs := range fields {
+		for _, field := range fs {
+			mf, ok := m.Fields[field.Key]
+			if !ok {
+				continue
+			}
+			value, ok := metricValue(field, mf.Unit)
+			if !ok {
+				continue
+			}
+			data = append(data, mf.datum(field.Key, value, e.Time, dims))
+		}
+	}
+	if len(data) == 0 {
+		return
+	}
+
+	m.mu.Lock()
+	m.buf = append(m.buf, data...)
+	if m.FlushInterval > 0 && len(m.buf) < maxMetricData {
+		if m.timer == nil {
+			m.timer = time.AfterFunc(m.FlushInterval, func() { m.Flush() })
+		}
+		m.mu.Unlock()
+		return
+	}
+	async := m.async
+	m.mu.Unlock()
+	if async {
+		gen := m.pending.start()
+		go func() {
+			defer m.pending.done(gen)
+			m.put()
+		}()
+		return
+	}
+	m.put()
+}
+
+// datum builds the datum of a field's value
+func (mf MetricField) datum(key string, value float64, at time.Time, fields map[string]string) *cloudwatch.MetricDatum {
+	name := mf.Name
+	if name == "" {
+		name = key
+	}
+	unit := mf.Unit
+	if unit == "" {
+		unit = cloudwatch.StandardUnitNone
+	}
+
+	datum := &cloudwatch.MetricDatum{
+		MetricName: aws.String(name),
+		Value:      aws.Float64(value),
+		Unit:       aws.String(unit),
+		Timestamp:  aws.Time(at),
+	}
+	for k, v := range mf.Dimensions {
+		datum.Dimensions = append(datum.Dimensions, &cloudwatch.Dimension{Name: aws.String(k), Value: aws.String(v)})
+	}
+	for _, k := range mf.DimensionFields {
+		if v, ok := fields[k]; ok {
+			datum.Dimensions = append(datum.Dimensions, &cloudwatch.Dimension{Name: aws.String(k), Value: aws.String(v)})
+		}
+	}
+	return datum
+}
+
+// metricValue returns the value of a numeric field, false for other fields
+// and values cloudwatch can't store
+func metricValue(field zapcore.Field, unit string) (float64, bool) {
+	var v float64
+	switch field.Type {
+	case zapcore.Int64Type, zapcore.Int32Type, zapcore.Int16Type, zapcore.Int8Type:
+		v = float64(field.Integer)
+	case zapcore.Uint64Type, zapcore.Uint32Type, zapcore.Uint16Type, zapcore.Uint8Type:
+		v = float64(uint64(field.Integer))
+	case zapcore.Float64Type:
+		v = math.Float64frombits(uint64(field.Integer))
+	case zapcore.Float32Type:
+		v = float64(math.Float32frombits(uint32(field.Integer)))
+	case zapcore.DurationType:
+		d := time.Duration(field.Integer)
+		switch unit {
+		case cloudwatch.StandardUnitMilliseconds:
+			v = float64(d) / float64(time.Millisecond)
+		case cloudwatch.StandardUnitMicroseconds:
+			v = float64(d) / float64(time.Microsecond)
+		default:
+			v = d.Seconds()
+		}
+	default:
+		return 0, false
+	}
+	return v, !math.IsNaN(v) && !math.IsInf(v, 0)
+}
+
+// Flush puts the buffered metric data and waits for puts in the
+// background. It is called by the hook's Flush.
+func (m *MetricsEmitter) Flush() error {
+	if m == nil {
+		return nil
+	}
+	err := m.put()
+	m.pending.wait()
+	return err
+}
+
+// put puts the buffered metric data
+func (m *MetricsEmitter) put() error {
+	m.mu.Lock()
+	data := m.buf
+	m.buf = nil
+	if m.timer != nil {
+		m.timer.Stop()
+		m.timer = nil
+	}
+	client := m.Client
+	m.mu.Unlock()
+
+	var err error
+	for len(data) > 0 && client != nil {
+		n := len(data)
+		if n > maxMetricData {
+			n = maxMetricData
+		}
+		_, perr := client.PutMetricData(&cloudwatch.PutMetricDataInput{
+			Namespace:  aws.String(m.Namespace),
+			MetricData: data[:n],
+		})
+		if perr != nil {
+			if m.onError != nil {
+				m.onError(perr)
+			}
+			if err == nil {
+				err = perr
+			}
+		}
+		data = data[n:]
+	}
+	return err
+}
+
+// setup builds the client, unless one is set, and passes failed puts to
+// onError. async puts unbuffered data in the background.
+func (m *MetricsEmitter) setup(cfg *aws.Config, onError func(error), async bool) error {
+	if m == nil {
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onError = onError
+	m.async = async
+	if m.Client != nil {
+		return nil
+	}
+	sess, err := newSession(cfg)
+	if err != nil {
+		return err
+	}
+	m.Client = cloudwatch.New(sess)
+	return nil
+}
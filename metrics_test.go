@@ -0,0 +1,107 @@
+package zapcloudwatch
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/cloudwatch/cloudwatchiface"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// mockMetrics records the metric data put to it. Puts wait for release, if
+// set, to be closed.
+type mockMetrics struct {
+	cloudwatchiface.CloudWatchAPI
+	release chan struct{}
+
+	mu   sync.Mutex
+	data []*cloudwatch.MetricDatum
+}
+
+func (m *mockMetrics) PutMetricData(in *cloudwatch.PutMetricDataInput) (*cloudwatch.PutMetricDataOutput, error) {
+	if m.release != nil {
+		<-m.release
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data = append(m.data, in.MetricData...)
+	return &cloudwatch.PutMetricDataOutput{}, nil
+}
+
+// values returns the values put, oldest first
+func (m *mockMetrics) values() []float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var values []float64
+	for _, d := range m.data {
+		values = append(values, aws.Float64Value(d.Value))
+	}
+	return values
+}
+
+func TestMetricsEmitter(t *testing.T) {
+	client := &mockMetrics{}
+	hook := &CloudwatchHook{Sink: &memSink{}, Metrics: &MetricsEmitter{
+		Client:    client,
+		Namespace: "app",
+		Fields: map[string]MetricField{
+			"latency": {Name: "Latency", Unit: cloudwatch.StandardUnitMilliseconds, DimensionFields: []string{"route"}},
+		},
+	}}
+	core, err := hook.GetCore(zapcore.DebugLevel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zap.New(core).Info("served", zap.String("route", "/v1"), zap.Duration("latency", 1500*time.Microsecond), zap.Int("status", 200))
+
+	// without FlushInterval or Async the datum is put right away
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	if len(client.data) != 1 {
+		t.Fatalf("put %d data, want the latency", len(client.data))
+	}
+	d := client.data[0]
+	if aws.StringValue(d.MetricName) != "Latency" || aws.Float64Value(d.Value) != 1.5 || aws.StringValue(d.Unit) != cloudwatch.StandardUnitMilliseconds {
+		t.Errorf("got %v", d)
+	}
+	if len(d.Dimensions) != 1 || aws.StringValue(d.Dimensions[0].Name) != "route" || aws.StringValue(d.Dimensions[0].Value) != "/v1" {
+		t.Errorf("got dimensions %v, want route=/v1", d.Dimensions)
+	}
+}
+
+func TestMetricsAsync(t *testing.T) {
+	client := &mockMetrics{release: make(chan struct{})}
+	hook := &CloudwatchHook{Sink: &memSink{}, Async: true, Metrics: &MetricsEmitter{
+		Client: client,
+		Fields: map[string]MetricField{"n": {}},
+	}}
+	core, err := hook.GetCore(zapcore.DebugLevel)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a slow PutMetricData doesn't hold up the write
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		zap.New(core).Info("hi", zap.Int("n", 1))
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the write waited for PutMetricData")
+	}
+
+	// Close waits for the put in the background
+	close(client.release)
+	if err := hook.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := client.values(); len(got) != 1 || got[0] != 1 {
+		t.Errorf("put %v, want [1]", got)
+	}
+}
@@ -0,0 +1,316 @@
+package zapcloudwatch
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs/cloudwatchlogsiface"
+)
+
+// mockLogs is an in-memory cloudwatch logs client. Streams must be created
+// before they are put to, as with cloudwatch. The on* hooks, if set, run
+// before each call of that kind and fail it with the error they return.
+type mockLogs struct {
+	cloudwatchlogsiface.CloudWatchLogsAPI
+
+	onDescribeGroups  func() error
+	onCreateGroup     func() error
+	onDescribeStreams func() error
+	onCreateStream    func() error
+	onPut             func(*cloudwatchlogs.PutLogEventsInput) error
+	// rejected is returned with every successful put
+	rejected *cloudwatchlogs.RejectedLogEventsInfo
+	// checkTokens fails puts whose sequence token isn't the stream's latest,
+	// saying which one is expected unless omitExpected is set
+	checkTokens  bool
+	omitExpected bool
+	// streamLag is how many describes leave out a stream just created
+	streamLag int
+
+	mu      sync.Mutex
+	groups  map[string]bool
+	streams map[string]string // "group/stream" to its sequence token
+	puts    []*cloudwatchlogs.PutLogEventsInput
+	calls   map[string]int
+	hidden  map[string]int // "group/stream" to the describes it stays unlisted in
+}
+
+// call counts a call and runs its hook, if any
+func (m *mockLogs) call(op string, hook func() error) error {
+	m.mu.Lock()
+	if m.calls == nil {
+		m.calls = make(map[string]int)
+	}
+	m.calls[op]++
+	m.mu.Unlock()
+
+	if hook != nil {
+		return hook()
+	}
+	return nil
+}
+
+// count returns how many calls of op were made, e.g. "PutLogEvents"
+func (m *mockLogs) count(op string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.calls[op]
+}
+
+// addStream makes a group and stream exist already
+func (m *mockLogs) addStream(group, stream string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.groups == nil {
+		m.groups = make(map[string]bool)
+	}
+	if m.streams == nil {
+		m.streams = make(map[string]string)
+	}
+	m.groups[group] = true
+	m.streams[group+"/"+stream] = ""
+}
+
+// messages returns the messages put to a stream, oldest first
+func (m *mockLogs) messages(group, stream string) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var msgs []string
+	for _, in := range m.puts {
+		if aws.StringValue(in.LogGroupName) == group && aws.StringValue(in.LogStreamName) == stream {
+			for _, e := range in.LogEvents {
+				msgs = append(msgs, aws.StringValue(e.Message))
+			}
+		}
+	}
+	return msgs
+}
+
+// putInputs returns the successful puts, oldest first
+func (m *mockLogs) putInputs() []*cloudwatchlogs.PutLogEventsInput {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]*cloudwatchlogs.PutLogEventsInput(nil), m.puts...)
+}
+
+func (m *mockLogs) DescribeLogGroupsWithContext(ctx aws.Context, in *cloudwatchlogs.DescribeLogGroupsInput, opts ...request.Option) (*cloudwatchlogs.DescribeLogGroupsOutput, error) {
+	if err := m.call("DescribeLogGroups", m.onDescribeGroups); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := &cloudwatchlogs.DescribeLogGroupsOutput{}
+	if m.groups[aws.StringValue(in.LogGroupNamePrefix)] {
+		out.LogGroups = []*cloudwatchlogs.LogGroup{{LogGroupName: in.LogGroupNamePrefix}}
+	}
+	return out, nil
+}
+
+func (m *mockLogs) CreateLogGroupWithContext(ctx aws.Context, in *cloudwatchlogs.CreateLogGroupInput, opts ...request.Option) (*cloudwatchlogs.CreateLogGroupOutput, error) {
+	if err := m.call("CreateLogGroup", m.onCreateGroup); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.groups[aws.StringValue(in.LogGroupName)] {
+		return nil, awserr.New(cloudwatchlogs.ErrCodeResourceAlreadyExistsException, "group exists", nil)
+	}
+	if m.groups == nil {
+		m.groups = make(map[string]bool)
+	}
+	m.groups[aws.StringValue(in.LogGroupName)] = true
+	return &cloudwatchlogs.CreateLogGroupOutput{}, nil
+}
+
+func (m *mockLogs) DescribeLogStreamsWithContext(ctx aws.Context, in *cloudwatchlogs.DescribeLogStreamsInput, opts ...request.Option) (*cloudwatchlogs.DescribeLogStreamsOutput, error) {
+	if err := m.call("DescribeLogStreams", m.onDescribeStreams); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := &cloudwatchlogs.DescribeLogStreamsOutput{}
+	key := aws.StringValue(in.LogGroupName) + "/" + aws.StringValue(in.LogStreamNamePrefix)
+	if m.hidden[key] > 0 {
+		m.hidden[key]--
+		return out, nil
+	}
+	if token, ok := m.streams[key]; ok {
+		ls := &cloudwatchlogs.LogStream{LogStreamName: in.LogStreamNamePrefix}
+		if token != "" {
+			ls.UploadSequenceToken = aws.String(token)
+		}
+		out.LogStreams = []*cloudwatchlogs.LogStream{ls}
+	}
+	return out, nil
+}
+
+func (m *mockLogs) CreateLogStreamWithContext(ctx aws.Context, in *cloudwatchlogs.CreateLogStreamInput, opts ...request.Option) (*cloudwatchlogs.CreateLogStreamOutput, error) {
+	if err := m.call("CreateLogStream", m.onCreateStream); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := aws.StringValue(in.LogGroupName) + "/" + aws.StringValue(in.LogStreamName)
+	if _, ok := m.streams[key]; ok {
+		return nil, awserr.New(cloudwatchlogs.ErrCodeResourceAlreadyExistsException, "stream exists", nil)
+	}
+	if m.streams == nil {
+		m.streams = make(map[string]string)
+	}
+	m.streams[key] = ""
+	if m.streamLag > 0 {
+		if m.hidden == nil {
+			m.hidden = make(map[string]int)
+		}
+		m.hidden[key] = m.streamLag
+	}
+	return &cloudwatchlogs.CreateLogStreamOutput{}, nil
+}
+
+func (m *mockLogs) PutLogEventsWithContext(ctx aws.Context, in *cloudwatchlogs.PutLogEventsInput, opts ...request.Option) (*cloudwatchlogs.PutLogEventsOutput, error) {
+	var hook func() error
+	if m.onPut != nil {
+		hook = func() error { return m.onPut(in) }
+	}
+	if err := m.call("PutLogEvents", hook); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := aws.StringValue(in.LogGroupName) + "/" + aws.StringValue(in.LogStreamName)
+	if _, ok := m.streams[key]; !ok {
+		return nil, awserr.New(cloudwatchlogs.ErrCodeResourceNotFoundException, "no such stream", nil)
+	}
+	if token := m.streams[key]; m.checkTokens && aws.StringValue(in.SequenceToken) != token {
+		var expected *string
+		if token != "" && !m.omitExpected {
+			expected = aws.String(token)
+		}
+		return nil, &cloudwatchlogs.InvalidSequenceTokenException{Message_: aws.String("bad token"), ExpectedSequenceToken: expected}
+	}
+	m.puts = append(m.puts, in)
+	next := strconv.Itoa(len(m.puts))
+	m.streams[key] = next
+	return &cloudwatchlogs.PutLogEventsOutput{NextSequenceToken: aws.String(next), RejectedLogEventsInfo: m.rejected}, nil
+}
+
+// memSink records the batches put to it. err, if set, fails every put.
+type memSink struct {
+	mu      sync.Mutex
+	err     error
+	batches [][]*cloudwatchlogs.InputLogEvent
+}
+
+func (s *memSink) Put(events []*cloudwatchlogs.InputLogEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	s.batches = append(s.batches, events)
+	return nil
+}
+
+// fail makes every later put fail with err, or succeed if err is nil
+func (s *memSink) fail(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err
+}
+
+// messages returns the messages put so far, oldest first
+func (s *memSink) messages() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var msgs []string
+	for _, batch := range s.batches {
+		for _, e := range batch {
+			msgs = append(msgs, aws.StringValue(e.Message))
+		}
+	}
+	return msgs
+}
+
+// puts returns how many puts succeeded
+func (s *memSink) puts() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.batches)
+}
+
+// waitFor polls cond until it holds or a second has passed
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// logsServer is a cloudwatch logs endpoint answering describe calls with the
+// group and stream existing and every other call with an empty object. It
+// passes every request to check, if set.
+func logsServer(t *testing.T, check func(*http.Request)) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if check != nil {
+			check(r)
+		}
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		switch strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "Logs_20140328.") {
+		case "DescribeLogGroups":
+			io.WriteString(w, `{"logGroups":[{"logGroupName":"group"}]}`)
+		case "DescribeLogStreams":
+			io.WriteString(w, `{"logStreams":[{"logStreamName":"stream"}]}`)
+		default:
+			io.WriteString(w, `{}`)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// serverConfig returns a config pointing the SDK to srv with static
+// credentials, so no real credentials are looked up
+func serverConfig(srv *httptest.Server) *aws.Config {
+	return aws.NewConfig().
+		WithRegion("us-east-1").
+		WithEndpoint(srv.URL).
+		WithMaxRetries(0).
+		WithCredentials(credentials.NewStaticCredentials("AKIDSTATIC", "secret", ""))
+}
+
+// failTimes returns a hook failing the first n calls with err
+func failTimes(n int, err error) func() error {
+	var mu sync.Mutex
+	return func() error {
+		mu.Lock()
+		defer mu.Unlock()
+		if n > 0 {
+			n--
+			return err
+		}
+		return nil
+	}
+}
+
+// throttled is the error cloudwatch throttles calls with
+var throttled = awserr.New("ThrottlingException", "rate exceeded", nil)
@@ -0,0 +1,56 @@
+package zapcloudwatch
+
+import (
+	"fmt"
+	"strings"
+)
+
+const maxNameLength = 512
+
+// sanitizeGroupName replaces characters not allowed in log group names,
+// which may only contain letters, digits and . - _ / #
+func sanitizeGroupName(name, replacement string) string {
+	return sanitizeName(name, replacement, func(r rune) bool {
+		return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune(".-_/#", r)
+	})
+}
+
+// sanitizeStreamName replaces the characters not allowed in log stream names
+func sanitizeStreamName(name, replacement string) string {
+	return sanitizeName(name, replacement, func(r rune) bool {
+		return r != ':' && r != '*'
+	})
+}
+
+func sanitizeName(name, replacement string, valid func(rune) bool) string {
+	var b strings.Builder
+	for _, r := range name {
+		if valid(r) {
+			b.WriteRune(r)
+		} else {
+			b.WriteString(replacement)
+		}
+	}
+	return truncate(b.String(), maxNameLength, "")
+}
+
+// sanitizeNames rewrites GroupName and StreamName if SanitizeNames is set,
+// reporting every substitution through OnError.
+func (ch *CloudwatchHook) sanitizeNames() {
+	if !ch.SanitizeNames {
+		return
+	}
+
+	replacement := ch.NameReplacement
+	if replacement == "" {
+		replacement = "_"
+	}
+	if name := sanitizeGroupName(ch.GroupName, replacement); name != ch.GroupName {
+		ch.reportError(fmt.Errorf("zapcloudwatch: log group name %q sanitized to %q", ch.GroupName, name))
+		ch.GroupName = name
+	}
+	if name := sanitizeStreamName(ch.StreamName, replacement); name != ch.StreamName {
+		ch.reportError(fmt.Errorf("zapcloudwatch: log stream name %q sanitized to %q", ch.StreamName, name))
+		ch.StreamName = name
+	}
+}
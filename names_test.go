@@ -0,0 +1,55 @@
+package zapcloudwatch
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSanitizeNames(t *testing.T) {
+	tests := []struct {
+		name        string
+		group       string
+		stream      string
+		replacement string
+		wantGroup   string
+		wantStream  string
+		wantErrors  int
+	}{
+		{"valid", "app/web-1_a.b#c", "i-123 [web]", "", "app/web-1_a.b#c", "i-123 [web]", 0},
+		{"group", "app web:prod", "stream", "", "app_web_prod", "stream", 1},
+		{"stream", "group", "host:8080/*", "", "group", "host_8080/_", 1},
+		{"both", "a b", "c:d", "-", "a-b", "c-d", 2},
+		{"unicode", "ünïcode", "ünïcode", "", "_n_code", "ünïcode", 1},
+		{"too long", strings.Repeat("g", 600), strings.Repeat("s", 600), "", strings.Repeat("g", maxNameLength), strings.Repeat("s", maxNameLength), 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var errs []error
+			ch := &CloudwatchHook{
+				GroupName:       tt.group,
+				StreamName:      tt.stream,
+				SanitizeNames:   true,
+				NameReplacement: tt.replacement,
+				OnError:         func(err error) { errs = append(errs, err) },
+			}
+			ch.sanitizeNames()
+			if ch.GroupName != tt.wantGroup {
+				t.Errorf("group = %q, want %q", ch.GroupName, tt.wantGroup)
+			}
+			if ch.StreamName != tt.wantStream {
+				t.Errorf("stream = %q, want %q", ch.StreamName, tt.wantStream)
+			}
+			if len(errs) != tt.wantErrors {
+				t.Errorf("reported %v, want %d substitutions", errs, tt.wantErrors)
+			}
+		})
+	}
+}
+
+func TestSanitizeNamesOff(t *testing.T) {
+	ch := &CloudwatchHook{GroupName: "a b", StreamName: "c:d"}
+	ch.sanitizeNames()
+	if ch.GroupName != "a b" || ch.StreamName != "c:d" {
+		t.Errorf("names rewritten to %q, %q without SanitizeNames", ch.GroupName, ch.StreamName)
+	}
+}
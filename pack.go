@@ -0,0 +1,56 @@
+package zapcloudwatch
+
+import (
+	"encoding/json"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+)
+
+const (
+	// maxEventSize is the largest event PutLogEvents accepts, counting the
+	// message bytes plus eventOverhead
+	maxEventSize  = 256 * 1024
+	eventOverhead = 26
+)
+
+// pack turns a batch into as few events as possible, each a JSON array of
+// the original events, split so no event exceeds maxEventSize.
+func pack(events []*cloudwatchlogs.InputLogEvent) []*cloudwatchlogs.InputLogEvent {
+	var packed []*cloudwatchlogs.InputLogEvent
+	var buf []byte
+	var first *int64
+
+	emit := func() {
+		if buf == nil {
+			return
+		}
+		packed = append(packed, &cloudwatchlogs.InputLogEvent{
+			Message:   aws.String(string(append(buf, ']'))),
+			Timestamp: first,
+		})
+		buf = nil
+	}
+
+	for _, event := range events {
+		item, err := json.Marshal(archivedEvent{
+			Timestamp: aws.Int64Value(event.Timestamp),
+			Message:   aws.StringValue(event.Message),
+		})
+		if err != nil {
+			continue
+		}
+		// the item, its separator and the closing bracket must fit
+		if buf != nil && len(buf)+1+len(item)+1+eventOverhead > maxEventSize {
+			emit()
+		}
+		if buf == nil {
+			buf = append([]byte{'['}, item...)
+			first = event.Timestamp
+		} else {
+			buf = append(append(buf, ','), item...)
+		}
+	}
+	emit()
+	return packed
+}
@@ -0,0 +1,68 @@
+package zapcloudwatch
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+)
+
+func TestPack(t *testing.T) {
+	tests := []struct {
+		name      string
+		count     int
+		size      int
+		wantPacks int
+	}{
+		{"small", 3, 10, 1},
+		{"exactly one", 1, 1000, 1},
+		// 100 * 10 KB events don't fit a 256 KB event
+		{"split", 100, 10 * 1024, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var events []*cloudwatchlogs.InputLogEvent
+			for i := 0; i < tt.count; i++ {
+				msg := fmt.Sprintf("%03d%s", i, strings.Repeat("x", tt.size-3))
+				events = append(events, &cloudwatchlogs.InputLogEvent{Message: aws.String(msg), Timestamp: aws.Int64(int64(1000 + i))})
+			}
+
+			packed := pack(events)
+			if len(packed) != tt.wantPacks {
+				t.Fatalf("packed into %d events, want %d", len(packed), tt.wantPacks)
+			}
+
+			var unpacked []archivedEvent
+			for _, p := range packed {
+				if size := eventSize(p); size > maxEventSize {
+					t.Errorf("packed event of %d bytes exceeds %d", size, maxEventSize)
+				}
+				var items []archivedEvent
+				if err := json.Unmarshal([]byte(aws.StringValue(p.Message)), &items); err != nil {
+					t.Fatalf("packed event isn't a JSON array: %v", err)
+				}
+				if len(items) == 0 || aws.Int64Value(p.Timestamp) != items[0].Timestamp {
+					t.Errorf("packed event has timestamp %d, want its first item's", aws.Int64Value(p.Timestamp))
+				}
+				unpacked = append(unpacked, items...)
+			}
+			if len(unpacked) != len(events) {
+				t.Fatalf("unpacked %d events, want %d", len(unpacked), len(events))
+			}
+			for i, e := range events {
+				if unpacked[i].Message != aws.StringValue(e.Message) || unpacked[i].Timestamp != aws.Int64Value(e.Timestamp) {
+					t.Errorf("event %d changed or out of order", i)
+				}
+			}
+		})
+	}
+}
+
+func TestPackEmpty(t *testing.T) {
+	if packed := pack(nil); len(packed) != 0 {
+		t.Errorf("packed nothing into %d events", len(packed))
+	}
+}
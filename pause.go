@@ -0,0 +1,104 @@
+package zapcloudwatch
+
+import (
+	"sync"
+
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+)
+
+// PausePolicy selects what happens to the batches a paused hook would put
+type PausePolicy int
+
+const (
+	// PauseHold keeps them, up to MaxPausedEvents, and puts them on Resume.
+	PauseHold PausePolicy = iota
+	// PauseDrop drops them.
+	PauseDrop
+)
+
+// pauseState holds the batches not put while the hook is paused
+type pauseState struct {
+	mu     sync.Mutex
+	paused bool
+	held   []heldBatch
+	events int
+}
+
+// heldBatch is a batch and the spool segment holding it
+type heldBatch struct {
+	events  []*cloudwatchlogs.InputLogEvent
+	segment string
+}
+
+// Pause stops the hook, and the streams it routes to, from putting anything,
+// e.g. during a planned cloudwatch maintenance or a load test. Entries are
+// still written and buffered as usual; the batches that would be put follow
+// WhilePaused instead.
+func (ch *CloudwatchHook) Pause() {
+	ch.setPaused(true)
+	for _, child := range ch.children() {
+		child.Pause()
+	}
+}
+
+// Resume lets a paused hook put again, first putting the batches held while
+// it was paused, and returns the first error of those puts. Close resumes
+// the hook too.
+func (ch *CloudwatchHook) Resume() error {
+	held := ch.setPaused(false)
+	var err error
+	for _, batch := range held {
+		if berr := ch.deliver(batch.events, batch.segment); err == nil {
+			err = berr
+		}
+	}
+	for _, child := range ch.children() {
+		if cerr := child.Resume(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// Paused reports whether the hook is paused
+func (ch *CloudwatchHook) Paused() bool {
+	ch.pause.mu.Lock()
+	defer ch.pause.mu.Unlock()
+	return ch.pause.paused
+}
+
+// setPaused pauses or resumes the hook, returning the batches held so far
+func (ch *CloudwatchHook) setPaused(paused bool) []heldBatch {
+	ch.pause.mu.Lock()
+	defer ch.pause.mu.Unlock()
+
+	ch.pause.paused = paused
+	if paused {
+		return nil
+	}
+	held := ch.pause.held
+	ch.pause.held, ch.pause.events = nil, 0
+	return held
+}
+
+// hold keeps or drops a batch the hook may not put because it is paused. It
+// reports false, having done neither, if the hook isn't paused.
+func (ch *CloudwatchHook) hold(events []*cloudwatchlogs.InputLogEvent, segment string) bool {
+	ch.pause.mu.Lock()
+	defer ch.pause.mu.Unlock()
+
+	if !ch.pause.paused {
+		return false
+	}
+	full := ch.MaxPausedEvents > 0 && ch.pause.events+len(events) > ch.MaxPausedEvents
+	if ch.WhilePaused == PauseDrop || full {
+		ch.debugf("zapcloudwatch: paused, dropping %d events", len(events))
+		ch.stats.dropped.Add(int64(len(events)))
+		ch.spool.remove(segment)
+		ch.acknowledge(events, ErrPausedDrop)
+		return true
+	}
+	ch.pause.held = append(ch.pause.held, heldBatch{events: events, segment: segment})
+	ch.pause.events += len(events)
+	return true
+}
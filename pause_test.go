@@ -0,0 +1,70 @@
+package zapcloudwatch
+
+import (
+	"fmt"
+	"testing"
+
+	"go.uber.org/zap/zapcore"
+)
+
+func TestPauseResume(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  PausePolicy
+		max     int
+		resumed []string
+		dropped int64
+	}{
+		{"hold", PauseHold, 0, []string{"[] b", "[] c", "[] d"}, 0},
+		{"hold up to max", PauseHold, 2, []string{"[] b", "[] c"}, 1},
+		{"drop", PauseDrop, 0, nil, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := &memSink{}
+			hook := &CloudwatchHook{Sink: sink, WhilePaused: tt.policy, MaxPausedEvents: tt.max}
+			hook.AddMessage(zapcore.InfoLevel, "a")
+
+			hook.Pause()
+			if !hook.Paused() {
+				t.Fatal("not paused after Pause")
+			}
+			for _, msg := range []string{"b", "c", "d"} {
+				hook.AddMessage(zapcore.InfoLevel, msg)
+			}
+			if got := sink.messages(); len(got) != 1 {
+				t.Fatalf("put %q while paused", got)
+			}
+
+			if err := hook.Resume(); err != nil {
+				t.Fatal(err)
+			}
+			if hook.Paused() {
+				t.Fatal("paused after Resume")
+			}
+			hook.AddMessage(zapcore.InfoLevel, "e")
+			hook.Close()
+
+			want := append(append([]string{"[] a"}, tt.resumed...), "[] e")
+			if got := sink.messages(); fmt.Sprintf("%q", got) != fmt.Sprintf("%q", want) {
+				t.Errorf("got %q, want %q", got, want)
+			}
+			if got := hook.Stats().Dropped; got != tt.dropped {
+				t.Errorf("dropped %d events, want %d", got, tt.dropped)
+			}
+		})
+	}
+}
+
+func TestCloseResumes(t *testing.T) {
+	sink := &memSink{}
+	hook := &CloudwatchHook{Sink: sink}
+	hook.Pause()
+	hook.AddMessage(zapcore.InfoLevel, "held")
+	if err := hook.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := sink.messages(); len(got) != 1 || got[0] != "[] held" {
+		t.Errorf("got %q, want the held event put on Close", got)
+	}
+}
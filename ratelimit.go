@@ -0,0 +1,139 @@
+package zapcloudwatch
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+// tokenBucket is a reservation based token bucket. Callers that exceed the
+// rate are made to wait instead of being rejected, so bursts are smoothed out
+// before they reach cloudwatch.
+type tokenBucket struct {
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// wait blocks until n events may be sent at the given rate per second.
+func (b *tokenBucket) wait(n int, rate float64) {
+	if rate <= 0 || n <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	now := time.Now()
+	burst := rate
+	if burst < 1 {
+		burst = 1
+	}
+	if b.last.IsZero() {
+		b.tokens = burst
+	} else {
+		b.tokens += now.Sub(b.last).Seconds() * rate
+		if b.tokens > burst {
+			b.tokens = burst
+		}
+	}
+	b.last = now
+	b.tokens -= float64(n)
+	debt := b.tokens
+	b.mu.Unlock()
+
+	if debt < 0 {
+		time.Sleep(time.Duration(-debt / rate * float64(time.Second)))
+	}
+}
+
+// eventLimiter returns the bucket MaxEventsPerSecond counts events against
+func (ch *CloudwatchHook) eventLimiter() *tokenBucket {
+	if ch.sharedLimiter != nil {
+		return ch.sharedLimiter
+	}
+	return &ch.limiter
+}
+
+// Limiter paces puts. Wait blocks until n more puts may be made.
+type Limiter interface {
+	Wait(n int)
+}
+
+// RateLimiter is a Limiter allowing a number of puts per second, smoothing
+// out bursts. Hooks given the same RateLimiter share its rate.
+type RateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	bucket tokenBucket
+}
+
+// NewRateLimiter returns a limiter allowing rate puts per second. Zero or
+// less means unlimited.
+func NewRateLimiter(rate float64) *RateLimiter {
+	return &RateLimiter{rate: rate}
+}
+
+// SharedPutLimiter is a limiter for all hooks of a process to share as their
+// PutLimiter, keeping their combined puts under the account's quota. It is
+// unlimited until SetRate is called.
+var SharedPutLimiter = NewRateLimiter(0)
+
+// SetRate changes the number of puts allowed per second
+func (l *RateLimiter) SetRate(rate float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rate = rate
+}
+
+func (l *RateLimiter) Wait(n int) {
+	l.mu.Lock()
+	rate := l.rate
+	l.mu.Unlock()
+	l.bucket.wait(n, rate)
+}
+
+// errorThrottle lets each kind of error through at most once per interval.
+// Errors are of the same kind if they have the same AWS error code, or
+// otherwise the same root cause, however they were wrapped.
+type errorThrottle struct {
+	mu   sync.Mutex
+	last map[string]time.Time
+}
+
+// errorKind returns what errorThrottle tells errors apart by: the AWS error
+// code, or the type and message of the innermost wrapped error
+func errorKind(err error) string {
+	var aerr awserr.Error
+	if errors.As(err, &aerr) {
+		return "aws:" + aerr.Code()
+	}
+	root := err
+	for next := errors.Unwrap(root); next != nil; next = errors.Unwrap(root) {
+		root = next
+	}
+	return fmt.Sprintf("%T:%s", root, root.Error())
+}
+
+// allow reports whether err may be reported now
+func (t *errorThrottle) allow(err error, interval time.Duration) bool {
+	if interval <= 0 {
+		return true
+	}
+
+	kind := errorKind(err)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	if last, ok := t.last[kind]; ok && now.Sub(last) < interval {
+		return false
+	}
+	if t.last == nil {
+		t.last = make(map[string]time.Time)
+	}
+	t.last[kind] = now
+	return true
+}
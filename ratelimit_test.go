@@ -0,0 +1,177 @@
+package zapcloudwatch
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestMaxEventsPerSecond(t *testing.T) {
+	const rate, events = 50, 75
+	sink := &memSink{}
+	hook := &CloudwatchHook{Sink: sink, MaxEventsPerSecond: rate}
+	if _, err := hook.GetHook(); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	for i := 0; i < events; i++ {
+		if err := hook.write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "tick"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	elapsed := time.Since(start)
+
+	// a full bucket lets the first second's worth through at once, the rest
+	// has to wait for tokens
+	if min := time.Duration(float64(events-rate) / rate * float64(time.Second) * 0.9); elapsed < min {
+		t.Fatalf("%d events took %v, want at least %v at %d per second", events, elapsed, min, rate)
+	}
+	if got := len(sink.messages()); got != events {
+		t.Fatalf("delivered %d events, want %d", got, events)
+	}
+}
+
+func TestMaxEventsPerSecondAcrossRoutes(t *testing.T) {
+	const rate, events = 50, 75
+	m := &mockLogs{}
+	hook := &CloudwatchHook{GroupName: "group", StreamName: "main", Client: m, MaxEventsPerSecond: rate,
+		StreamNameFunc: func(e zapcore.Entry) string { return e.LoggerName }}
+	if _, err := hook.GetHook(); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	for i := 0; i < events; i++ {
+		e := zapcore.Entry{Level: zapcore.InfoLevel, LoggerName: fmt.Sprint("s", i%3), Message: "tick"}
+		if err := hook.write(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	elapsed := time.Since(start)
+
+	// the routes share the hook's rate rather than each having their own
+	if min := time.Duration(float64(events-rate) / rate * float64(time.Second) * 0.9); elapsed < min {
+		t.Fatalf("%d events over 3 routes took %v, want at least %v at %d per second", events, elapsed, min, rate)
+	}
+}
+
+func TestSharedRateLimiter(t *testing.T) {
+	const rate, puts = 20, 15
+	limiter := NewRateLimiter(rate)
+	sinks := []*memSink{{}, {}}
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for _, sink := range sinks {
+		hook := &CloudwatchHook{Sink: sink, PutLimiter: limiter}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < puts; i++ {
+				hook.write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "tick"})
+			}
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	// each hook alone fits in the burst, together they have to wait
+	if min := time.Duration(float64(2*puts-rate) / rate * float64(time.Second) * 0.9); elapsed < min {
+		t.Fatalf("%d puts took %v, want at least %v at %d per second", 2*puts, elapsed, min, rate)
+	}
+	for i, sink := range sinks {
+		if got := len(sink.messages()); got != puts {
+			t.Errorf("hook %d delivered %d events, want %d", i, got, puts)
+		}
+	}
+
+	// lifting the rate lets both through at once
+	limiter.SetRate(0)
+	start = time.Now()
+	for _, sink := range sinks {
+		hook := &CloudwatchHook{Sink: sink, PutLimiter: limiter}
+		for i := 0; i < puts; i++ {
+			hook.write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "tick"})
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("unlimited puts took %v", elapsed)
+	}
+}
+
+func TestTokenBucketRate(t *testing.T) {
+	const rate, events = 50, 75
+	var b tokenBucket
+
+	start := time.Now()
+	for i := 0; i < events; i++ {
+		b.wait(1, rate)
+	}
+	elapsed := time.Since(start)
+
+	// a full bucket lets the first second's worth through at once, the rest
+	// has to wait for tokens
+	if min := time.Duration(float64(events-rate) / rate * float64(time.Second) * 0.9); elapsed < min {
+		t.Fatalf("%d events took %v, want at least %v at %d per second", events, elapsed, min, rate)
+	}
+}
+
+func TestTokenBucketUnlimited(t *testing.T) {
+	var b tokenBucket
+	start := time.Now()
+	for i := 0; i < 1000; i++ {
+		b.wait(100, 0)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Fatalf("unlimited bucket waited %v", elapsed)
+	}
+}
+
+func TestErrorThrottle(t *testing.T) {
+	refused := errors.New("connection refused")
+	tests := []struct {
+		name  string
+		first error
+		then  error
+		want  bool
+	}{
+		{"same error", refused, refused, false},
+		{"wrapped differently", fmt.Errorf("put failed: %w", refused), fmt.Errorf("create stream: %w", fmt.Errorf("dial: %w", refused)), false},
+		{"same type, other cause", fmt.Errorf("a: %w", refused), fmt.Errorf("a: %w", errors.New("no such host")), true},
+		{"same aws code", awserr.New("ThrottlingException", "rate exceeded", nil), fmt.Errorf("put: %w", awserr.New("ThrottlingException", "slow down", nil)), false},
+		{"other aws code", awserr.New("ThrottlingException", "rate exceeded", nil), awserr.New("ServiceUnavailableException", "rate exceeded", nil), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var throttle errorThrottle
+			if !throttle.allow(tt.first, time.Hour) {
+				t.Fatal("first error held back")
+			}
+			if got := throttle.allow(tt.then, time.Hour); got != tt.want {
+				t.Errorf("second error allowed = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestErrorIntervalElapsed(t *testing.T) {
+	var throttle errorThrottle
+	err := errors.New("boom")
+	throttle.allow(err, 20*time.Millisecond)
+	if throttle.allow(err, 20*time.Millisecond) {
+		t.Fatal("repeat allowed within the interval")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if !throttle.allow(err, 20*time.Millisecond) {
+		t.Error("repeat held back after the interval")
+	}
+	if !throttle.allow(err, 0) {
+		t.Error("held back without an interval")
+	}
+}
@@ -0,0 +1,131 @@
+package zapcloudwatch
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+)
+
+const defaultSetupRetryBackoff = 100 * time.Millisecond
+
+// defaultPutRetryBackoff is the wait before a put is first tried again. It
+// doubles after every attempt.
+const defaultPutRetryBackoff = 50 * time.Millisecond
+
+// streamPollInterval is how often a new stream is described while waiting
+// for it to become visible
+const streamPollInterval = 100 * time.Millisecond
+
+// ErrStreamNotVisible is reported when a stream just created still isn't
+// listed once ConfirmStreamTimeout has passed.
+var ErrStreamNotVisible = errors.New("zapcloudwatch: created log stream is not visible yet")
+
+// retrySetup calls fn until it succeeds, fails with a permanent error or runs
+// out of the attempts allowed by SetupRetries.
+func (ch *CloudwatchHook) retrySetup(ctx context.Context, fn func() error) error {
+	backoff := ch.SetupRetryBackoff
+	if backoff <= 0 {
+		backoff = defaultSetupRetryBackoff
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= ch.SetupRetries || !isRetryable(err) {
+			return err
+		}
+
+		ch.debugf("zapcloudwatch: retrying setup call in %v: %v", backoff, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		ch.stats.retry()
+	}
+}
+
+// putRetrying puts events, trying again after retryable errors until
+// MaxRetryDuration has passed
+func (ch *CloudwatchHook) putRetrying(events []*cloudwatchlogs.InputLogEvent) error {
+	deadline := time.Now().Add(ch.MaxRetryDuration)
+	backoff := defaultPutRetryBackoff
+	for {
+		err := ch.put(events)
+		if err == nil || ch.MaxRetryDuration <= 0 || !isRetryable(err) {
+			return err
+		}
+
+		left := time.Until(deadline)
+		if left <= 0 {
+			return err
+		}
+		if backoff > left {
+			backoff = left
+		}
+		ch.debugf("zapcloudwatch: retrying put in %v: %v", backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+		ch.stats.retry()
+	}
+}
+
+// isRetryable reports whether err is a throttling or transient error worth
+// trying again rather than a permanent one such as missing permissions.
+func isRetryable(err error) bool {
+	// the SDK only recognizes its own errors, not ones wrapping them
+	var aerr awserr.Error
+	if errors.As(err, &aerr) {
+		err = aerr
+	}
+	return request.IsErrorThrottle(err) || request.IsErrorRetryable(err)
+}
+
+// waitForStream describes the log stream until it is listed or
+// ConfirmStreamTimeout has passed, riding out the lag before a stream just
+// created can be written to.
+func (ch *CloudwatchHook) waitForStream(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, ch.ConfirmStreamTimeout)
+	defer cancel()
+
+	for {
+		resp, err := ch.svc.DescribeLogStreamsWithContext(ctx, &cloudwatchlogs.DescribeLogStreamsInput{
+			LogGroupName:        aws.String(ch.GroupName),
+			LogStreamNamePrefix: aws.String(ch.StreamName),
+		})
+		if err == nil {
+			for _, stream := range resp.LogStreams {
+				if aws.StringValue(stream.LogStreamName) == ch.StreamName {
+					return nil
+				}
+			}
+		} else if !isRetryable(err) && ctx.Err() == nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ErrStreamNotVisible
+		case <-time.After(streamPollInterval):
+		}
+	}
+}
+
+// warmUp makes a describe call, if WarmUp is set, for the connection it
+// opens. What it returns doesn't matter: even a call the role isn't allowed
+// to make leaves the connection ready for the first put.
+func (ch *CloudwatchHook) warmUp(ctx context.Context) {
+	if !ch.WarmUp {
+		return
+	}
+	ch.svc.DescribeLogStreamsWithContext(ctx, &cloudwatchlogs.DescribeLogStreamsInput{
+		LogGroupName:        aws.String(ch.GroupName),
+		LogStreamNamePrefix: aws.String(ch.StreamName),
+		Limit:               aws.Int64(1),
+	})
+}
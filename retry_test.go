@@ -0,0 +1,172 @@
+package zapcloudwatch
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestRetrySetupTransientErrors(t *testing.T) {
+	m := &mockLogs{onDescribeGroups: failTimes(2, throttled)}
+	m.addStream("group", "stream")
+	hook := &CloudwatchHook{GroupName: "group", StreamName: "stream", Client: m, SetupRetries: 3, SetupRetryBackoff: time.Millisecond}
+
+	if _, err := hook.GetHook(); err != nil {
+		t.Fatalf("setup failed despite retries: %v", err)
+	}
+	if n := m.count("DescribeLogGroups"); n != 3 {
+		t.Fatalf("described groups %d times, want 2 failures and a success", n)
+	}
+	if n := hook.Stats().Retried; n != 2 {
+		t.Fatalf("counted %d retries, want 2", n)
+	}
+}
+
+func TestRetrySetupGivesUp(t *testing.T) {
+	m := &mockLogs{onDescribeGroups: failTimes(5, throttled)}
+	hook := &CloudwatchHook{GroupName: "group", StreamName: "stream", Client: m, SetupRetries: 2, SetupRetryBackoff: time.Millisecond}
+
+	if _, err := hook.GetHook(); err != throttled {
+		t.Fatalf("got %v, want the throttling error once retries ran out", err)
+	}
+	if n := m.count("DescribeLogGroups"); n != 3 {
+		t.Fatalf("described groups %d times, want 3", n)
+	}
+}
+
+func TestRetrySetupPermanentError(t *testing.T) {
+	denied := awserr.New("AccessDeniedException", "not allowed", nil)
+	m := &mockLogs{onDescribeGroups: failTimes(1, denied)}
+	hook := &CloudwatchHook{GroupName: "group", StreamName: "stream", Client: m, SetupRetries: 3, SetupRetryBackoff: time.Millisecond}
+
+	if _, err := hook.GetHook(); err != denied {
+		t.Fatalf("got %v, want the access denied error", err)
+	}
+	if n := m.count("DescribeLogGroups"); n != 1 {
+		t.Fatalf("retried a permanent error: %d calls", n)
+	}
+}
+
+func TestMaxRetryDuration(t *testing.T) {
+	denied := awserr.New("AccessDeniedException", "not allowed", nil)
+	tests := []struct {
+		name      string
+		failures  int
+		err       error
+		minPuts   int
+		maxPuts   int
+		delivered bool
+	}{
+		{"recovers", 2, throttled, 3, 3, true},
+		// backing off from 50ms, 300ms allows 3 or 4 attempts
+		{"gives up", 1000, throttled, 3, 5, false},
+		{"permanent", 1000, denied, 1, 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fail := failTimes(tt.failures, tt.err)
+			m := &mockLogs{onPut: func(*cloudwatchlogs.PutLogEventsInput) error { return fail() }}
+			m.addStream("group", "stream")
+			fallback := &memSink{}
+			hook := &CloudwatchHook{GroupName: "group", StreamName: "stream", Client: m, MaxRetryDuration: 300 * time.Millisecond, FallbackSink: fallback}
+
+			start := time.Now()
+			hook.AddMessage(zapcore.InfoLevel, "hi")
+			took := time.Since(start)
+			hook.Close()
+
+			if n := m.count("PutLogEvents"); n < tt.minPuts || n > tt.maxPuts {
+				t.Errorf("made %d puts, want %d to %d", n, tt.minPuts, tt.maxPuts)
+			}
+			if tt.maxPuts > tt.minPuts && (took < 250*time.Millisecond || took > time.Second) {
+				t.Errorf("gave up after %v, want about MaxRetryDuration", took)
+			}
+			if tt.delivered {
+				checkMessages(t, m, "group", "stream", "[] hi")
+			} else if got := fallback.messages(); len(got) != 1 {
+				t.Errorf("fallback got %q, want the undelivered event", got)
+			}
+		})
+	}
+}
+
+func TestThrottledTokenDescribe(t *testing.T) {
+	for _, exists := range []bool{true, false} {
+		m := &mockLogs{onDescribeStreams: func() error { return throttled }, checkTokens: true}
+		m.addStream("group", "other")
+		if exists {
+			m.addStream("group", "stream")
+			m.streams["group/stream"] = "5"
+		}
+		hook := &CloudwatchHook{GroupName: "group", StreamName: "stream", Client: m}
+		if _, err := hook.GetCore(zapcore.DebugLevel); err != nil {
+			t.Fatalf("stream exists %v: setup failed on a throttled describe: %v", exists, err)
+		}
+
+		// the first put picks up the expected token or creates the stream
+		hook.AddMessage(zapcore.InfoLevel, "hi")
+		if err := hook.Close(); err != nil {
+			t.Fatal(err)
+		}
+		checkMessages(t, m, "group", "stream", "[] hi")
+	}
+}
+
+func TestConfirmStreamLag(t *testing.T) {
+	m := &mockLogs{streamLag: 2}
+	hook := &CloudwatchHook{GroupName: "group", StreamName: "stream", Client: m, ConfirmStreamTimeout: 5 * time.Second, OnError: func(err error) { t.Error(err) }}
+
+	if _, err := hook.GetHook(); err != nil {
+		t.Fatal(err)
+	}
+	// one describe before creating, two while the stream lags and the last
+	// one listing it
+	if n := m.count("DescribeLogStreams"); n != 4 {
+		t.Errorf("described streams %d times, want 4", n)
+	}
+}
+
+func TestConfirmStreamTimeout(t *testing.T) {
+	m := &mockLogs{streamLag: 100}
+	var errs []error
+	hook := &CloudwatchHook{GroupName: "group", StreamName: "stream", Client: m, ConfirmStreamTimeout: 150 * time.Millisecond, OnError: func(err error) { errs = append(errs, err) }}
+
+	start := time.Now()
+	if _, err := hook.GetHook(); err != nil {
+		t.Fatalf("setup failed because the stream stayed invisible: %v", err)
+	}
+	if took := time.Since(start); took > time.Second {
+		t.Errorf("setup took %v, want it to give up after ConfirmStreamTimeout", took)
+	}
+	if len(errs) != 1 || errs[0] != ErrStreamNotVisible {
+		t.Errorf("OnError got %v, want ErrStreamNotVisible", errs)
+	}
+}
+
+func TestWarmUp(t *testing.T) {
+	for _, warm := range []bool{false, true} {
+		// a describe the role may not make still opens the connection
+		m := &mockLogs{onDescribeStreams: func() error { return awserr.New("AccessDeniedException", "explicit deny", nil) }}
+		m.addStream("group", "stream")
+		hook := &CloudwatchHook{GroupName: "group", StreamName: "stream", Client: m, PutOnly: true, WarmUp: warm}
+		if _, err := hook.GetCore(zapcore.DebugLevel); err != nil {
+			t.Fatalf("WarmUp %v: %v", warm, err)
+		}
+		want := 0
+		if warm {
+			want = 1
+		}
+		if n := m.count("DescribeLogStreams"); n != want {
+			t.Errorf("WarmUp %v: described streams %d times during setup, want %d", warm, n, want)
+		}
+
+		hook.AddMessage(zapcore.InfoLevel, "hi")
+		if err := hook.Close(); err != nil {
+			t.Fatal(err)
+		}
+		checkMessages(t, m, "group", "stream", "[] hi")
+	}
+}
@@ -0,0 +1,368 @@
+package zapcloudwatch
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// destination is a log group and stream entries can be routed to
+type destination struct {
+	group  string
+	stream string
+}
+
+// router holds a child hook for every destination other than the hook's own.
+// Each child has its own buffer, flush timer and sequence tokens, so
+// destinations are delivered independently. Routes are kept in order of
+// use, most recent first, so idle ones can be reaped from the back.
+type router struct {
+	mu     sync.Mutex
+	routes map[destination]*list.Element
+	lru    list.List
+	// streams holds every destination routed to, up to MaxStreams
+	streams map[destination]struct{}
+	// closing holds the reaped children still being closed. Their stats
+	// are added to the parent's once they are.
+	closing map[*CloudwatchHook]struct{}
+}
+
+// route is a child hook and when it was last written to
+type route struct {
+	dest destination
+	hook *CloudwatchHook
+	used time.Time
+	// writers counts the writes in progress, which keep the route from
+	// being reaped
+	writers int
+}
+
+// routing reports whether entries may go anywhere but the hook's own stream
+func (ch *CloudwatchHook) routing() bool {
+	return ch.GroupRouter != nil || ch.StreamNameFunc != nil
+}
+
+// destination picks where an entry goes. A non-empty stream, such as one
+// from the entry's context, wins over StreamNameFunc and the hook's own.
+func (ch *CloudwatchHook) destination(e zapcore.Entry, stream string) destination {
+	dest := destination{group: ch.GroupName, stream: ch.StreamName}
+	if ch.GroupRouter != nil {
+		if group := ch.GroupRouter(e); group != "" {
+			dest.group = group
+		}
+	}
+	if stream == "" && ch.StreamNameFunc != nil {
+		stream = ch.StreamNameFunc(e)
+	}
+	if stream != "" {
+		dest.stream = stream
+	}
+	return dest
+}
+
+// StreamRule sends the entries it matches to a stream of their group
+type StreamRule struct {
+	// Match reports whether an entry goes to Stream. Nil matches every entry.
+	Match func(zapcore.Entry) bool
+	// Stream is the stream matching entries go to. Empty means StreamName.
+	Stream string
+}
+
+// MinLevel returns a StreamRule match for entries at level or above
+func MinLevel(level zapcore.Level) func(zapcore.Entry) bool {
+	return func(e zapcore.Entry) bool {
+		return e.Level >= level
+	}
+}
+
+// fanOut returns the destinations of every rule matching an entry, each
+// once, in the order of the rules
+func (ch *CloudwatchHook) fanOut(e zapcore.Entry) []destination {
+	var dests []destination
+	for _, rule := range ch.StreamRules {
+		if rule.Match != nil && !rule.Match(e) {
+			continue
+		}
+		stream := rule.Stream
+		if stream == "" {
+			stream = ch.StreamName
+		}
+		dest := ch.admit(ch.destination(e, stream))
+		seen := false
+		for _, d := range dests {
+			seen = seen || d == dest
+		}
+		if !seen {
+			dests = append(dests, dest)
+		}
+	}
+	return dests
+}
+
+// writeFanOut writes an entry to every one of dests, returning the first
+// error. Its ack, if set, is told nil once every copy was delivered, and the
+// first error otherwise.
+func (ch *CloudwatchHook) writeFanOut(dests []destination, e zapcore.Entry, d delivery) error {
+	ack := d.ack
+	var acks []*entryAck
+	var err error
+	for _, dest := range dests {
+		var c *entryAck
+		if ack != nil {
+			c = newEntryAck()
+			acks = append(acks, c)
+		}
+
+		var derr error
+		if dest == (destination{ch.GroupName, ch.StreamName}) {
+			derr = ch.sendOwn(e, delivery{ack: c, dupKey: d.dupKey})
+		} else {
+			derr = ch.writeRoute(dest, e, delivery{ack: c, dupKey: d.dupKey})
+		}
+		if derr != nil {
+			if c != nil {
+				c.fail(derr)
+			}
+			if err == nil {
+				err = derr
+			}
+		}
+	}
+
+	if ack != nil {
+		ack.handed.Store(true)
+		go func() {
+			var aerr error
+			for _, c := range acks {
+				if cerr := <-c.c; aerr == nil {
+					aerr = cerr
+				}
+			}
+			ack.tell(aerr)
+		}()
+	}
+	return err
+}
+
+// ErrTooManyStreams is reported when an entry would go to a new stream
+// beyond MaxStreams and goes to the overflow stream instead.
+var ErrTooManyStreams = errors.New("zapcloudwatch: too many log streams")
+
+// admit returns dest if it is within MaxStreams, and the overflow stream of
+// its group otherwise
+func (ch *CloudwatchHook) admit(dest destination) destination {
+	if ch.MaxStreams <= 0 || dest.stream == ch.StreamName || dest.stream == ch.OverflowStream {
+		return dest
+	}
+
+	ch.routes.mu.Lock()
+	_, known := ch.routes.streams[dest]
+	if !known && len(ch.routes.streams) < ch.MaxStreams {
+		if ch.routes.streams == nil {
+			ch.routes.streams = make(map[destination]struct{})
+		}
+		ch.routes.streams[dest] = struct{}{}
+		known = true
+	}
+	ch.routes.mu.Unlock()
+	if known {
+		return dest
+	}
+
+	ch.reportError(fmt.Errorf("%w: not creating %q in %q", ErrTooManyStreams, dest.stream, dest.group))
+	dest.stream = ch.OverflowStream
+	if dest.stream == "" {
+		dest.stream = ch.StreamName
+	}
+	return dest
+}
+
+// route returns the route to dest, creating it on first use, held for a
+// write until it is released. A child shares the parent's settings and
+// client; its group and stream are set up on its first write. Routes idle
+// for longer than RouteIdleTimeout, or beyond MaxRoutes, are closed.
+func (ch *CloudwatchHook) route(dest destination) *route {
+	if r := ch.cachedRoute(dest); r != nil {
+		return r
+	}
+
+	ch.routes.mu.Lock()
+	child := ch.child()
+	svc := ch.svc
+	ch.routes.mu.Unlock()
+	child.GroupName = dest.group
+	child.StreamName = dest.stream
+	if ch.SpoolDir != "" {
+		child.SpoolDir = filepath.Join(ch.SpoolDir, url.PathEscape(dest.group), url.PathEscape(dest.stream))
+	}
+	// ConfigureRoute runs without routes.mu held, so it may use the parent,
+	// e.g. to log through it
+	if ch.ConfigureRoute != nil {
+		ch.ConfigureRoute(dest.group, dest.stream, child)
+	}
+
+	ch.routes.mu.Lock()
+	defer ch.routes.mu.Unlock()
+	now := time.Now()
+	defer ch.reapRoutes(now)
+
+	// another write may have created the route meanwhile. The child made
+	// here was never set up, so there is nothing to close.
+	if el, ok := ch.routes.routes[dest]; ok {
+		return ch.useRoute(el, now)
+	}
+	// and SetAWSConfig may have replaced the client the child copied
+	if child.Client == svc && ch.svc != svc {
+		child.Client = ch.svc
+		child.AWSConfig = ch.AWSConfig
+	}
+	if ch.Paused() {
+		child.setPaused(true)
+	}
+
+	if ch.routes.routes == nil {
+		ch.routes.routes = make(map[destination]*list.Element)
+	}
+	r := &route{dest: dest, hook: child, used: now, writers: 1}
+	ch.routes.routes[dest] = ch.routes.lru.PushFront(r)
+	return r
+}
+
+// cachedRoute returns the route to dest, held for a write, if it exists
+func (ch *CloudwatchHook) cachedRoute(dest destination) *route {
+	ch.routes.mu.Lock()
+	defer ch.routes.mu.Unlock()
+
+	el, ok := ch.routes.routes[dest]
+	if !ok {
+		return nil
+	}
+	now := time.Now()
+	defer ch.reapRoutes(now)
+	return ch.useRoute(el, now)
+}
+
+// useRoute holds the route of el for a write, marking it used at now.
+// routes.mu must be held.
+func (ch *CloudwatchHook) useRoute(el *list.Element, now time.Time) *route {
+	r := el.Value.(*route)
+	r.used = now
+	r.writers++
+	ch.routes.lru.MoveToFront(el)
+	return r
+}
+
+// release ends a write through a route returned by route
+func (ch *CloudwatchHook) release(r *route) {
+	ch.routes.mu.Lock()
+	defer ch.routes.mu.Unlock()
+	r.writers--
+}
+
+// reapRoutes closes the least recently used routes while there are more
+// than MaxRoutes, and those idle for longer than RouteIdleTimeout. Routes
+// being written to are left for a later call. They are closed in the
+// background; Flush and Close wait for them. routes.mu must be held.
+func (ch *CloudwatchHook) reapRoutes(now time.Time) {
+	for el := ch.routes.lru.Back(); el != nil; {
+		r := el.Value.(*route)
+		over := ch.MaxRoutes > 0 && ch.routes.lru.Len() > ch.MaxRoutes
+		idle := ch.RouteIdleTimeout > 0 && now.Sub(r.used) > ch.RouteIdleTimeout
+		if !over && !idle {
+			return
+		}
+
+		next := el.Prev()
+		if r.writers == 0 {
+			ch.routes.lru.Remove(el)
+			delete(ch.routes.routes, r.dest)
+			if ch.routes.closing == nil {
+				ch.routes.closing = make(map[*CloudwatchHook]struct{})
+			}
+			ch.routes.closing[r.hook] = struct{}{}
+			gen := ch.pending.start()
+			go func() {
+				defer ch.pending.done(gen)
+				if err := r.hook.Close(); err != nil {
+					ch.reportError(err)
+				}
+				ch.retire(r.hook)
+			}()
+		}
+		el = next
+	}
+}
+
+// retire adds the stats of a reaped child that was closed to the parent's,
+// so they aren't lost with it
+func (ch *CloudwatchHook) retire(child *CloudwatchHook) {
+	ch.routes.mu.Lock()
+	defer ch.routes.mu.Unlock()
+	ch.stats.add(child.Stats())
+	delete(ch.routes.closing, child)
+}
+
+// writeRoute writes an entry through the child hook for dest, which isn't
+// reaped until the write is done.
+func (ch *CloudwatchHook) writeRoute(dest destination, e zapcore.Entry, d delivery) error {
+	r := ch.route(dest)
+	defer ch.release(r)
+	return r.hook.send(e, "", d)
+}
+
+// child copies the exported settings of the hook into a new hook that does no
+// routing of its own
+func (ch *CloudwatchHook) child() *CloudwatchHook {
+	child := &CloudwatchHook{}
+	src := reflect.ValueOf(ch).Elem()
+	dst := reflect.ValueOf(child).Elem()
+	for i := 0; i < src.NumField(); i++ {
+		if src.Type().Field(i).IsExported() {
+			dst.Field(i).Set(src.Field(i))
+		}
+	}
+
+	child.GroupRouter = nil
+	child.StreamContextKey = nil
+	child.StreamNameFunc = nil
+	child.StreamRules = nil
+	child.ConfigureRoute = nil
+	if child.Client == nil {
+		child.Client = ch.svc
+	}
+	child.sharedLimiter = ch.eventLimiter()
+	// the process is the same for every route, so the parent's metadata is
+	// reused rather than looked up again. Setup adds the child's SourceTag.
+	if child.ResourceMetadata {
+		child.ResourceMetadata = false
+		for k, v := range ch.metadata {
+			if k == sourceKey {
+				continue
+			}
+			if child.metadata == nil {
+				child.metadata = make(map[string]string, len(ch.metadata))
+			}
+			child.metadata[k] = v
+		}
+	}
+	return child
+}
+
+// children returns the child hooks currently routed to
+func (ch *CloudwatchHook) children() []*CloudwatchHook {
+	ch.routes.mu.Lock()
+	defer ch.routes.mu.Unlock()
+
+	children := make([]*CloudwatchHook, 0, ch.routes.lru.Len())
+	for el := ch.routes.lru.Front(); el != nil; el = el.Next() {
+		children = append(children, el.Value.(*route).hook)
+	}
+	return children
+}
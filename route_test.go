@@ -0,0 +1,306 @@
+package zapcloudwatch
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// checkMessages fails the test unless a stream of m got exactly want
+func checkMessages(t *testing.T, m *mockLogs, group, stream string, want ...string) {
+	t.Helper()
+	got := m.messages(group, stream)
+	if fmt.Sprintf("%q", got) != fmt.Sprintf("%q", want) {
+		t.Errorf("%s/%s got %q, want %q", group, stream, got, want)
+	}
+}
+
+func TestGroupRouter(t *testing.T) {
+	m := &mockLogs{}
+	m.addStream("app", "web")
+	hook := &CloudwatchHook{
+		GroupName:  "app",
+		StreamName: "web",
+		Client:     m,
+		GroupRouter: func(e zapcore.Entry) string {
+			if e.LoggerName == "audit" {
+				return "audit"
+			}
+			return ""
+		},
+	}
+	core, err := hook.GetCore(zapcore.DebugLevel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := zap.New(core)
+
+	logger.Info("request served")
+	logger.Named("audit").Info("user deleted", zap.Int("uid", 7))
+	logger.Named("audit").Info("user created")
+	logger.Named("db").Warn("slow query")
+	if err := hook.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	checkMessages(t, m, "app", "web", "[] request served {}", "[db] slow query {}")
+	checkMessages(t, m, "audit", "web", `[audit] user deleted {"uid":7}`, "[audit] user created {}")
+	if n := m.count("CreateLogGroup"); n != 1 {
+		t.Errorf("created %d groups, want the audit one", n)
+	}
+}
+
+func TestReapWhileWriting(t *testing.T) {
+	m := &mockLogs{}
+	hook := &CloudwatchHook{
+		GroupName:   "group",
+		StreamName:  "main",
+		Client:      m,
+		MaxRoutes:   1,
+		Async:       true,
+		GroupRouter: func(e zapcore.Entry) string { return e.LoggerName },
+		OnError:     func(err error) { t.Error(err) },
+	}
+	core, err := hook.GetCore(zapcore.DebugLevel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := zap.New(core)
+
+	// every write to another group goes over MaxRoutes and reaps the
+	// route others may still be writing to
+	const writers, writes = 16, 200
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < writes; j++ {
+				logger.Named(fmt.Sprint("s", (i+j)%4)).Info("hello")
+			}
+		}(i)
+	}
+	wg.Wait()
+	if err := hook.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var delivered int
+	for i := 0; i < 4; i++ {
+		delivered += len(m.messages(fmt.Sprint("s", i), "main"))
+	}
+	if delivered != writers*writes {
+		t.Errorf("delivered %d events, want %d", delivered, writers*writes)
+	}
+}
+
+func TestStreamNameFuncCache(t *testing.T) {
+	m := &mockLogs{}
+	hook := &CloudwatchHook{
+		GroupName:      "group",
+		StreamName:     "main",
+		Client:         m,
+		MaxRoutes:      2,
+		StreamNameFunc: func(e zapcore.Entry) string { return e.LoggerName },
+	}
+	core, err := hook.GetCore(zapcore.DebugLevel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := zap.New(core)
+
+	// a is used again before c comes in, so b is the one evicted, and a
+	// when b comes back
+	for _, stream := range []string{"a", "b", "a", "a", "c", "b"} {
+		logger.Named(stream).Info("hi")
+	}
+	var cached []string
+	for _, child := range hook.children() {
+		cached = append(cached, child.StreamName)
+	}
+	if fmt.Sprint(cached) != "[b c]" {
+		t.Errorf("cached %v, want [b c], most recent first", cached)
+	}
+	if err := hook.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// hits reuse the stream set up already, b is set up anew. main, the
+	// hook's own, is set up too.
+	if n := m.count("DescribeLogStreams"); n != 5 {
+		t.Errorf("described streams %d times, want 5", n)
+	}
+	if n := m.count("CreateLogStream"); n != 4 {
+		t.Errorf("created %d streams, want 4", n)
+	}
+	checkMessages(t, m, "group", "a", "[a] hi {}", "[a] hi {}", "[a] hi {}")
+	checkMessages(t, m, "group", "b", "[b] hi {}", "[b] hi {}")
+	checkMessages(t, m, "group", "c", "[c] hi {}")
+}
+
+func TestMaxStreamsOverflow(t *testing.T) {
+	m := &mockLogs{}
+	var errs []error
+	hook := &CloudwatchHook{
+		GroupName:      "group",
+		StreamName:     "main",
+		Client:         m,
+		MaxStreams:     2,
+		OverflowStream: "overflow",
+		StreamNameFunc: func(e zapcore.Entry) string { return e.LoggerName },
+		OnError:        func(err error) { errs = append(errs, err) },
+	}
+	core, err := hook.GetCore(zapcore.DebugLevel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := zap.New(core)
+
+	// main and overflow don't count, streams seen already stay admitted
+	for _, stream := range []string{"a", "", "b", "c", "a", "overflow", "d"} {
+		logger.Named(stream).Info("hi")
+	}
+	if err := hook.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	checkMessages(t, m, "group", "a", "[a] hi {}", "[a] hi {}")
+	checkMessages(t, m, "group", "b", "[b] hi {}")
+	checkMessages(t, m, "group", "main", "[] hi {}")
+	checkMessages(t, m, "group", "overflow", "[c] hi {}", "[overflow] hi {}", "[d] hi {}")
+	if len(errs) != 2 || !errors.Is(errs[0], ErrTooManyStreams) || !errors.Is(errs[1], ErrTooManyStreams) {
+		t.Errorf("reported %v, want ErrTooManyStreams for c and d", errs)
+	}
+}
+
+func TestConfigureRoute(t *testing.T) {
+	m := &mockLogs{}
+	var hook *CloudwatchHook
+	hook = &CloudwatchHook{
+		GroupName:      "group",
+		StreamName:     "main",
+		Client:         m,
+		StreamNameFunc: func(e zapcore.Entry) string { return e.LoggerName },
+		ConfigureRoute: func(group, stream string, route *CloudwatchHook) {
+			// the parent can be used from here
+			hook.AddMessage(zapcore.InfoLevel, fmt.Sprintf("routing to %s after %d events", stream, hook.Stats().Enqueued))
+			if stream == "quiet" {
+				route.BatchSize = 2
+			}
+		},
+	}
+	core, err := hook.GetCore(zapcore.DebugLevel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := zap.New(core)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		logger.Named("quiet").Info("one")
+		logger.Named("loud").Info("two")
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("writing deadlocked in ConfigureRoute")
+	}
+
+	// quiet got its own BatchSize and waits for a second event
+	if got := m.messages("group", "quiet"); len(got) != 0 {
+		t.Errorf("quiet got %q before its batch was full", got)
+	}
+	logger.Named("quiet").Info("three")
+	checkMessages(t, m, "group", "quiet", "[quiet] one {}", "[quiet] three {}")
+	checkMessages(t, m, "group", "loud", "[loud] two {}")
+	if err := hook.Close(); err != nil {
+		t.Fatal(err)
+	}
+	checkMessages(t, m, "group", "main", "[] routing to quiet after 0 events", "[] routing to loud after 2 events")
+}
+
+func TestStreamRules(t *testing.T) {
+	m := &mockLogs{}
+	hook := &CloudwatchHook{
+		GroupName:  "group",
+		StreamName: "main",
+		Client:     m,
+		StreamRules: []StreamRule{
+			{Match: MinLevel(zapcore.WarnLevel), Stream: "alerts"},
+			{Stream: "all"},
+		},
+	}
+	core, err := hook.GetCore(zapcore.DebugLevel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := zap.New(core)
+	logger.Info("started")
+	logger.Warn("disk low")
+	// each copy is acknowledged before the entry is
+	ack := hook.AddEntryAck(zapcore.Entry{Time: time.Now(), Level: zapcore.ErrorLevel, Message: "disk full"})
+	if err := <-ack; err != nil {
+		t.Errorf("acked %v", err)
+	}
+	if err := hook.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	checkMessages(t, m, "group", "alerts", "[] disk low {}", "[] disk full")
+	checkMessages(t, m, "group", "all", "[] started {}", "[] disk low {}", "[] disk full")
+	checkMessages(t, m, "group", "main")
+}
+
+func TestRoutesReuseMetadata(t *testing.T) {
+	var lookups atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lookups.Add(1)
+		switch r.URL.Path {
+		case "/v4":
+			w.Write([]byte(`{"DockerId":"c0ffee"}`))
+		case "/v4/task":
+			w.Write([]byte(`{"Cluster":"prod"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	m := &mockLogs{}
+	hook := &CloudwatchHook{
+		GroupName:        "group",
+		StreamName:       "main",
+		Client:           m,
+		ResourceMetadata: true,
+		ECSMetadataURI:   srv.URL + "/v4",
+		SourceTag:        "api",
+		StreamNameFunc:   func(e zapcore.Entry) string { return e.LoggerName },
+	}
+	core, err := hook.GetCore(zapcore.DebugLevel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := zap.New(core)
+	for _, stream := range []string{"a", "b", "c"} {
+		logger.Named(stream).Info("hello")
+	}
+	hook.Close()
+
+	// the container and the task are looked up once, by the parent
+	if n := lookups.Load(); n != 2 {
+		t.Errorf("made %d metadata requests, want 2", n)
+	}
+	want := `[c] hello {"container_id":"c0ffee","ecs_cluster":"prod","source":"api"}`
+	if got := m.messages("group", "c"); len(got) != 1 || got[0] != want {
+		t.Errorf("route got %q, want %q", got, want)
+	}
+}
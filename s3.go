@@ -0,0 +1,115 @@
+package zapcloudwatch
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"sync/atomic"
+	"text/template"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+// DefaultS3KeyTemplate names archived batches by time and sequence number
+const DefaultS3KeyTemplate = `{{.Time.Format "2006/01/02/150405.000000000"}}-{{.Seq}}.jsonl`
+
+// S3Sink archives batches to S3 as compressed JSON lines. It is meant to be
+// used as a hook's FallbackSink so events survive long cloudwatch outages.
+type S3Sink struct {
+	Client s3iface.S3API
+	Bucket string
+	// Codec compresses the objects. Defaults to gzip.
+	Codec Codec
+	// Prefix is prepended to every object key.
+	Prefix string
+	// KeyTemplate is a text/template for the rest of the key, executed with
+	// Time, Seq, Group and Stream. Defaults to DefaultS3KeyTemplate.
+	KeyTemplate string
+	// Group and Stream are made available to KeyTemplate.
+	Group  string
+	Stream string
+
+	seq uint64
+}
+
+// S3KeyData is the data KeyTemplate is executed with
+type S3KeyData struct {
+	Time   time.Time
+	Seq    uint64
+	Group  string
+	Stream string
+}
+
+// archivedEvent is the JSON line written for each event
+type archivedEvent struct {
+	Timestamp int64  `json:"timestamp"`
+	Message   string `json:"message"`
+}
+
+func (s *S3Sink) Put(events []*cloudwatchlogs.InputLogEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	key, err := s.key()
+	if err != nil {
+		return err
+	}
+
+	codec := s.Codec
+	if codec == nil {
+		codec = GzipCodec{}
+	}
+
+	var buf bytes.Buffer
+	zw, err := codec.NewWriter(&buf)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(zw)
+	for _, event := range events {
+		line := archivedEvent{
+			Timestamp: aws.Int64Value(event.Timestamp),
+			Message:   aws.StringValue(event.Message),
+		}
+		if err := enc.Encode(line); err != nil {
+			return err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	_, err = s.Client.PutObject(&s3.PutObjectInput{
+		Bucket:      aws.String(s.Bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(buf.Bytes()),
+		ContentType: aws.String("application/x-ndjson"),
+	})
+	return err
+}
+
+func (s *S3Sink) key() (string, error) {
+	text := s.KeyTemplate
+	if text == "" {
+		text = DefaultS3KeyTemplate
+	}
+	tmpl, err := template.New("key").Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	var key strings.Builder
+	key.WriteString(s.Prefix)
+	err = tmpl.Execute(&key, S3KeyData{
+		Time:   time.Now().UTC(),
+		Seq:    atomic.AddUint64(&s.seq, 1),
+		Group:  s.Group,
+		Stream: s.Stream,
+	})
+	return key.String(), err
+}
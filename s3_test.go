@@ -0,0 +1,91 @@
+package zapcloudwatch
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"go.uber.org/zap/zapcore"
+)
+
+// mockS3 records the objects put to it
+type mockS3 struct {
+	s3iface.S3API
+
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (m *mockS3) PutObject(in *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+	body, err := io.ReadAll(in.Body)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.objects == nil {
+		m.objects = make(map[string][]byte)
+	}
+	m.objects[aws.StringValue(in.Bucket)+"/"+aws.StringValue(in.Key)] = body
+	return &s3.PutObjectOutput{}, nil
+}
+
+func TestS3SinkOnDeliveryFailure(t *testing.T) {
+	m := &mockS3{}
+	sink := &memSink{}
+	sink.fail(errors.New("cloudwatch unavailable"))
+	hook := &CloudwatchHook{
+		Sink:         sink,
+		FallbackSink: &S3Sink{Client: m, Bucket: "archive", Prefix: "logs/", KeyTemplate: "{{.Group}}/{{.Stream}}/{{.Seq}}.jsonl.gz", Group: "app", Stream: "web"},
+	}
+	if _, err := hook.GetHook(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := hook.write(zapcore.Entry{Level: zapcore.ErrorLevel, Message: "lost"}); err == nil {
+		t.Fatal("put to a failing sink succeeded")
+	}
+
+	body, ok := m.objects["archive/logs/app/web/1.jsonl.gz"]
+	if !ok {
+		t.Fatalf("objects written: %v", m.objects)
+	}
+	zr, err := gzip.NewReader(strings.NewReader(string(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []archivedEvent
+	scanner := bufio.NewScanner(zr)
+	for scanner.Scan() {
+		var line archivedEvent
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) != 1 || lines[0].Message != "[] lost" || lines[0].Timestamp == 0 {
+		t.Fatalf("archived %+v", lines)
+	}
+}
+
+func TestS3SinkNothingOnSuccess(t *testing.T) {
+	m := &mockS3{}
+	hook := &CloudwatchHook{Sink: &memSink{}, FallbackSink: &S3Sink{Client: m, Bucket: "archive"}}
+	if _, err := hook.GetHook(); err != nil {
+		t.Fatal(err)
+	}
+	if err := hook.write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "delivered"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.objects) != 0 {
+		t.Fatalf("archived %d objects of a delivered batch", len(m.objects))
+	}
+}
@@ -0,0 +1,289 @@
+package zapcloudwatch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs/cloudwatchlogsiface"
+)
+
+// Sink delivers formatted events. The default sink puts them to the hook's
+// log stream; others can write to a file, record them for tests or forward
+// them elsewhere.
+type Sink interface {
+	Put(events []*cloudwatchlogs.InputLogEvent) error
+}
+
+// ContextSink is a Sink whose puts can be abandoned once ctx is done. The
+// hook uses PutWithContext when a SendTimeout is set.
+type ContextSink interface {
+	Sink
+	PutWithContext(ctx context.Context, events []*cloudwatchlogs.InputLogEvent) error
+}
+
+// streamState is what a sink tracks for each log stream it writes to. Every
+// stream is serialized on its own lock, so puts to different streams don't
+// wait on each other.
+type streamState struct {
+	mu    sync.Mutex
+	token *string
+}
+
+// cloudwatchSink puts events to log streams of a single group, keeping track
+// of each stream's sequence token between puts. Put writes to the default
+// stream.
+type cloudwatchSink struct {
+	svc    cloudwatchlogsiface.CloudWatchLogsAPI
+	group  string
+	stream string
+	// onError is told about events rejected by an otherwise successful put
+	onError func(error)
+	// store, if set, persists every stream's latest token
+	store TokenStore
+	// opts are applied to every put
+	opts []request.Option
+	// stats, if set, counts puts made again
+	stats *hookStats
+	// putOnly leaves missing streams alone rather than creating them
+	putOnly bool
+	// debugf is told about streams created and tokens refreshed
+	debugf func(format string, args ...interface{})
+
+	// mu guards svc and streams
+	mu      sync.Mutex
+	streams map[string]*streamState
+}
+
+// state returns the state of a stream, creating it on first use
+func (s *cloudwatchSink) state(stream string) *streamState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.streams == nil {
+		s.streams = make(map[string]*streamState)
+	}
+	st, ok := s.streams[stream]
+	if !ok {
+		st = &streamState{}
+		s.streams[stream] = st
+	}
+	return st
+}
+
+// debug passes a diagnostic to debugf, if set
+func (s *cloudwatchSink) debug(format string, args ...interface{}) {
+	if s.debugf != nil {
+		s.debugf(format, args...)
+	}
+}
+
+// client returns the client puts go through
+func (s *cloudwatchSink) client() cloudwatchlogsiface.CloudWatchLogsAPI {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.svc
+}
+
+// setClient replaces the client, keeping every stream's token
+func (s *cloudwatchSink) setClient(svc cloudwatchlogsiface.CloudWatchLogsAPI) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.svc = svc
+}
+
+func (s *cloudwatchSink) Put(events []*cloudwatchlogs.InputLogEvent) error {
+	return s.putStream(context.Background(), s.stream, events)
+}
+
+func (s *cloudwatchSink) PutWithContext(ctx context.Context, events []*cloudwatchlogs.InputLogEvent) error {
+	return s.putStream(ctx, s.stream, events)
+}
+
+// putStream puts events to the named stream, creating the stream if
+// cloudwatch doesn't know it yet.
+func (s *cloudwatchSink) putStream(ctx context.Context, stream string, events []*cloudwatchlogs.InputLogEvent) error {
+	events = chronological(events)
+	st := s.state(stream)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	resp, err := s.put(ctx, stream, st.token, events)
+	if !s.putOnly && isErrorCode(err, cloudwatchlogs.ErrCodeResourceNotFoundException) {
+		_, err = s.client().CreateLogStreamWithContext(ctx, &cloudwatchlogs.CreateLogStreamInput{
+			LogGroupName:  aws.String(s.group),
+			LogStreamName: aws.String(stream),
+		})
+		if err == nil || isErrorCode(err, cloudwatchlogs.ErrCodeResourceAlreadyExistsException) {
+			s.debug("zapcloudwatch: created log stream %s/%s", s.group, stream)
+			st.token = nil
+			s.stats.retry()
+			resp, err = s.put(ctx, stream, nil, events)
+		}
+	}
+
+	// a stale token, e.g. one loaded from a TokenStore, is replaced by the one
+	// cloudwatch expects.
+	var invalid *cloudwatchlogs.InvalidSequenceTokenException
+	if errors.As(err, &invalid) && invalid.ExpectedSequenceToken != nil {
+		s.debug("zapcloudwatch: retrying put to %s/%s with the expected sequence token", s.group, stream)
+		s.stats.retry()
+		resp, err = s.put(ctx, stream, invalid.ExpectedSequenceToken, events)
+	}
+	// after a long idle the error may not say which token is expected, or
+	// the expected one may be outdated too. Ask for the stream's own.
+	if errors.As(err, &invalid) {
+		var token *string
+		if token, err = s.describeToken(ctx, stream); err == nil {
+			s.debug("zapcloudwatch: refreshed sequence token of %s/%s", s.group, stream)
+			s.stats.retry()
+			resp, err = s.put(ctx, stream, token, events)
+		}
+	}
+
+	// if the batch was in fact accepted already, we're done
+	var accepted *cloudwatchlogs.DataAlreadyAcceptedException
+	if errors.As(err, &accepted) {
+		s.saveToken(stream, st, accepted.ExpectedSequenceToken)
+		return nil
+	}
+
+	if err != nil {
+		return s.putError(stream, err)
+	}
+	if resp == nil {
+		return nil
+	}
+	s.saveToken(stream, st, resp.NextSequenceToken)
+	if info := resp.RejectedLogEventsInfo; info != nil && s.onError != nil {
+		s.onError(&RejectedEventsError{
+			TooNewStartIndex: info.TooNewLogEventStartIndex,
+			TooOldEndIndex:   info.TooOldLogEventEndIndex,
+			ExpiredEndIndex:  info.ExpiredLogEventEndIndex,
+		})
+	}
+	return nil
+}
+
+// chronological returns events in the order of their timestamps, as a put
+// needs them, keeping the order of those with the same. Entries written
+// concurrently can be buffered a little out of order.
+func chronological(events []*cloudwatchlogs.InputLogEvent) []*cloudwatchlogs.InputLogEvent {
+	less := func(i, j int) bool {
+		return aws.Int64Value(events[i].Timestamp) < aws.Int64Value(events[j].Timestamp)
+	}
+	if sort.SliceIsSorted(events, less) {
+		return events
+	}
+	events = append([]*cloudwatchlogs.InputLogEvent(nil), events...)
+	sort.SliceStable(events, less)
+	return events
+}
+
+// describeToken looks up the current sequence token of a stream
+func (s *cloudwatchSink) describeToken(ctx context.Context, stream string) (*string, error) {
+	resp, err := s.client().DescribeLogStreamsWithContext(ctx, &cloudwatchlogs.DescribeLogStreamsInput{
+		LogGroupName:        aws.String(s.group),
+		LogStreamNamePrefix: aws.String(stream),
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, ls := range resp.LogStreams {
+		if aws.StringValue(ls.LogStreamName) == stream {
+			return ls.UploadSequenceToken, nil
+		}
+	}
+	return nil, nil
+}
+
+// saveToken records the next token of a stream. st.mu must be held.
+func (s *cloudwatchSink) saveToken(stream string, st *streamState, token *string) {
+	st.token = token
+	if s.store == nil {
+		return
+	}
+	if err := s.store.SaveToken(s.group, stream, token); err != nil && s.onError != nil {
+		s.onError(err)
+	}
+}
+
+func (s *cloudwatchSink) put(ctx context.Context, stream string, token *string, events []*cloudwatchlogs.InputLogEvent) (*cloudwatchlogs.PutLogEventsOutput, error) {
+	return s.client().PutLogEventsWithContext(ctx, &cloudwatchlogs.PutLogEventsInput{
+		LogEvents:     events,
+		LogGroupName:  aws.String(s.group),
+		LogStreamName: aws.String(stream),
+		SequenceToken: token,
+	}, s.opts...)
+}
+
+// putError wraps the error of a failed put to stream
+func (s *cloudwatchSink) putError(stream string, err error) error {
+	perr := &PutError{Group: s.group, Stream: stream, Err: err}
+	var reqErr awserr.RequestFailure
+	if errors.As(err, &reqErr) {
+		perr.RequestID = reqErr.RequestID()
+	}
+	return perr
+}
+
+// PutError is the error of a put that failed. OnError is passed one for
+// every such put.
+type PutError struct {
+	Group  string
+	Stream string
+	// RequestID identifies the request to AWS support. It is empty when the
+	// put failed before AWS answered.
+	RequestID string
+	Err       error
+}
+
+func (e *PutError) Error() string {
+	return fmt.Sprintf("zapcloudwatch: putting events to %s/%s: %v", e.Group, e.Stream, e.Err)
+}
+
+func (e *PutError) Unwrap() error {
+	return e.Err
+}
+
+// isErrorCode reports whether err is an AWS error with the given code
+func isErrorCode(err error, code string) bool {
+	var aerr awserr.Error
+	return errors.As(err, &aerr) && aerr.Code() == code
+}
+
+// RejectedEventsError reports events of a batch that cloudwatch refused even
+// though the put itself succeeded. Indexes count the events in the order of
+// their timestamps and are nil when that reason doesn't apply.
+type RejectedEventsError struct {
+	// TooNewStartIndex is the first event too far in the future.
+	TooNewStartIndex *int64
+	// TooOldEndIndex is the last event older than cloudwatch accepts.
+	TooOldEndIndex *int64
+	// ExpiredEndIndex is the last event older than the log group's retention.
+	ExpiredEndIndex *int64
+}
+
+func (e *RejectedEventsError) Error() string {
+	var reasons []string
+	if e.ExpiredEndIndex != nil {
+		reasons = append(reasons, fmt.Sprintf("events up to index %d are older than the log group's retention period, adjust the retention or the event timestamps", *e.ExpiredEndIndex))
+	}
+	if e.TooOldEndIndex != nil {
+		reasons = append(reasons, fmt.Sprintf("events up to index %d are too old", *e.TooOldEndIndex))
+	}
+	if e.TooNewStartIndex != nil {
+		reasons = append(reasons, fmt.Sprintf("events from index %d on are too far in the future", *e.TooNewStartIndex))
+	}
+	if len(reasons) == 0 {
+		return "zapcloudwatch: events rejected"
+	}
+	return "zapcloudwatch: events rejected: " + strings.Join(reasons, "; ")
+}
@@ -0,0 +1,249 @@
+package zapcloudwatch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestMemorySink(t *testing.T) {
+	sink := &memSink{}
+	m := &mockLogs{}
+	hook := &CloudwatchHook{GroupName: "group", StreamName: "stream", Client: m, Sink: sink, BatchSize: 2}
+	core, err := hook.GetCore(zapcore.DebugLevel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := zap.New(core)
+
+	logger.Info("one")
+	logger.Info("two", zap.String("k", "v"))
+	logger.Info("three")
+	if err := hook.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"[] one {}", `[] two {"k":"v"}`, "[] three {}"}
+	got := sink.messages()
+	if len(got) != len(want) {
+		t.Fatalf("sink got %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("event %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+	if n := sink.puts(); n != 2 {
+		t.Errorf("sink got %d puts, want a batch of 2 and one of 1", n)
+	}
+	for _, op := range []string{"DescribeLogGroups", "DescribeLogStreams", "PutLogEvents"} {
+		if n := m.count(op); n != 0 {
+			t.Errorf("made %d %s calls though a sink is set", n, op)
+		}
+	}
+}
+
+func TestRejectedEvents(t *testing.T) {
+	m := &mockLogs{rejected: &cloudwatchlogs.RejectedLogEventsInfo{ExpiredLogEventEndIndex: aws.Int64(0)}}
+	m.addStream("group", "stream")
+	var errs []error
+	hook := &CloudwatchHook{GroupName: "group", StreamName: "stream", Client: m, OnError: func(err error) { errs = append(errs, err) }}
+	core, err := hook.GetCore(zapcore.DebugLevel)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	zap.New(core).Info("ancient")
+	if err := hook.Close(); err != nil {
+		t.Fatalf("close failed though the put succeeded: %v", err)
+	}
+
+	if len(errs) != 1 {
+		t.Fatalf("OnError got %v, want one rejection", errs)
+	}
+	var rejected *RejectedEventsError
+	if !errors.As(errs[0], &rejected) {
+		t.Fatalf("OnError got %T, want a *RejectedEventsError", errs[0])
+	}
+	if rejected.ExpiredEndIndex == nil || *rejected.ExpiredEndIndex != 0 {
+		t.Errorf("ExpiredEndIndex = %v, want 0", rejected.ExpiredEndIndex)
+	}
+	if rejected.TooOldEndIndex != nil || rejected.TooNewStartIndex != nil {
+		t.Errorf("reported reasons cloudwatch didn't give: %v", rejected)
+	}
+	if !strings.Contains(rejected.Error(), "retention") {
+		t.Errorf("error %q doesn't mention the retention period", rejected)
+	}
+}
+
+func TestPutErrorRequestID(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		id   string
+	}{
+		{"request failure", awserr.NewRequestFailure(awserr.New("ServiceUnavailableException", "down", nil), http.StatusServiceUnavailable, "req-1234"), "req-1234"},
+		{"no answer", errors.New("connection reset"), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &mockLogs{onPut: func(*cloudwatchlogs.PutLogEventsInput) error { return tt.err }}
+			m.addStream("group", "stream")
+			var errs []error
+			hook := &CloudwatchHook{GroupName: "group", StreamName: "stream", Client: m, OnError: func(err error) { errs = append(errs, err) }}
+			hook.AddMessage(zapcore.InfoLevel, "lost")
+			hook.Close()
+
+			var perr *PutError
+			if len(errs) != 1 || !errors.As(errs[0], &perr) {
+				t.Fatalf("OnError got %v, want one *PutError", errs)
+			}
+			if perr.RequestID != tt.id || perr.Group != "group" || perr.Stream != "stream" {
+				t.Errorf("got request %q to %s/%s, want request %q to group/stream", perr.RequestID, perr.Group, perr.Stream, tt.id)
+			}
+			if !errors.Is(perr, tt.err) {
+				t.Errorf("%v doesn't wrap %v", perr, tt.err)
+			}
+		})
+	}
+}
+
+func TestPutStreamsConcurrently(t *testing.T) {
+	const streams, puts = 10, 20
+
+	// the first put to every stream waits until all of them are in flight,
+	// which only happens if streams don't wait on each other
+	var inFlight sync.WaitGroup
+	inFlight.Add(streams)
+	var first sync.Map
+	allInFlight := make(chan struct{})
+	go func() {
+		inFlight.Wait()
+		close(allInFlight)
+	}()
+	m := &mockLogs{checkTokens: true, onPut: func(in *cloudwatchlogs.PutLogEventsInput) error {
+		if _, seen := first.LoadOrStore(aws.StringValue(in.LogStreamName), true); !seen {
+			inFlight.Done()
+			select {
+			case <-allInFlight:
+			case <-time.After(time.Second):
+				t.Error("puts to different streams were serialized")
+			}
+		}
+		return nil
+	}}
+	s := &cloudwatchSink{svc: m, group: "group"}
+	for i := 0; i < streams; i++ {
+		m.addStream("group", fmt.Sprint("stream-", i))
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < streams; i++ {
+		wg.Add(1)
+		go func(stream string) {
+			defer wg.Done()
+			for j := 0; j < puts; j++ {
+				event := &cloudwatchlogs.InputLogEvent{Message: aws.String(fmt.Sprint(j)), Timestamp: aws.Int64(1)}
+				if err := s.putStream(context.Background(), stream, []*cloudwatchlogs.InputLogEvent{event}); err != nil {
+					t.Errorf("put to %s: %v", stream, err)
+				}
+			}
+		}(fmt.Sprint("stream-", i))
+	}
+	wg.Wait()
+
+	for i := 0; i < streams; i++ {
+		got := m.messages("group", fmt.Sprint("stream-", i))
+		if len(got) != puts {
+			t.Fatalf("stream-%d got %d events, want %d", i, len(got), puts)
+		}
+		for j, msg := range got {
+			if msg != fmt.Sprint(j) {
+				t.Errorf("stream-%d event %d = %q, out of order", i, j, msg)
+			}
+		}
+	}
+	if n := m.count("PutLogEvents"); n != streams*puts {
+		t.Errorf("made %d puts, want %d without a token retry", n, streams*puts)
+	}
+}
+
+func TestRequestOptions(t *testing.T) {
+	var mu sync.Mutex
+	headers := make(map[string]string)
+	srv := logsServer(t, func(r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		headers[strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "Logs_20140328.")] = r.Header.Get("X-Tenant")
+	})
+	hook := &CloudwatchHook{
+		GroupName:      "group",
+		StreamName:     "stream",
+		AWSConfig:      serverConfig(srv),
+		RequestOptions: []request.Option{request.WithSetRequestHeaders(map[string]string{"X-Tenant": "acme"})},
+	}
+	if err := hook.AddMessage(zapcore.InfoLevel, "hi"); err != nil {
+		t.Fatal(err)
+	}
+	hook.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if got := headers["PutLogEvents"]; got != "acme" {
+		t.Errorf("put had X-Tenant %q, want the request option applied", got)
+	}
+	if got := headers["DescribeLogGroups"]; got != "" {
+		t.Errorf("describe had X-Tenant %q, want options limited to puts", got)
+	}
+}
+
+func TestStaleToken(t *testing.T) {
+	tests := []struct {
+		name         string
+		omitExpected bool
+		wantPuts     int
+		wantDescribe int
+	}{
+		{"expected token given", false, 2, 0},
+		{"expected token omitted", true, 2, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &mockLogs{checkTokens: true, omitExpected: tt.omitExpected}
+			m.addStream("group", "stream")
+			s := &cloudwatchSink{svc: m, group: "group", stream: "stream"}
+			if err := s.Put([]*cloudwatchlogs.InputLogEvent{{Message: aws.String("before"), Timestamp: aws.Int64(1)}}); err != nil {
+				t.Fatal(err)
+			}
+
+			// another writer moved the stream on while this one was idle
+			m.mu.Lock()
+			m.streams["group/stream"] = "moved-on"
+			m.mu.Unlock()
+			puts, describes := m.count("PutLogEvents"), m.count("DescribeLogStreams")
+
+			if err := s.Put([]*cloudwatchlogs.InputLogEvent{{Message: aws.String("after"), Timestamp: aws.Int64(2)}}); err != nil {
+				t.Fatalf("put with a stale token failed: %v", err)
+			}
+			if n := m.count("PutLogEvents") - puts; n != tt.wantPuts {
+				t.Errorf("made %d puts, want %d", n, tt.wantPuts)
+			}
+			if n := m.count("DescribeLogStreams") - describes; n != tt.wantDescribe {
+				t.Errorf("described the stream %d times, want %d", n, tt.wantDescribe)
+			}
+			checkMessages(t, m, "group", "stream", "before", "after")
+		})
+	}
+}
@@ -0,0 +1,233 @@
+package zapcloudwatch
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+)
+
+const (
+	spoolSuffix = ".seg"
+	// maxSpoolLine leaves room for a maximum size event with every
+	// character escaped
+	maxSpoolLine = 2 << 20
+)
+
+// spool keeps events on disk until they are delivered. Each batch lives in
+// its own append-only segment file of JSON lines, named so segments sort in
+// the order they were written, even across restarts. A nil spool does nothing.
+type spool struct {
+	mu    sync.Mutex
+	dir   string
+	codec Codec
+	seq   uint64
+
+	active *segment
+}
+
+// segment is an open segment file and the writer events are encoded to,
+// which compresses them if the spool has a codec.
+type segment struct {
+	f *os.File
+	w io.WriteCloser
+}
+
+func (s *spool) create(name string) (*segment, error) {
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	seg := &segment{f: f, w: f}
+	if s.codec != nil {
+		if seg.w, err = s.codec.NewWriter(f); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	return seg, nil
+}
+
+// write appends an event and flushes any compressor, so the event is on
+// disk even if the segment is never closed.
+func (seg *segment) write(event *cloudwatchlogs.InputLogEvent) error {
+	line, err := json.Marshal(archivedEvent{
+		Timestamp: aws.Int64Value(event.Timestamp),
+		Message:   aws.StringValue(event.Message),
+	})
+	if err != nil {
+		return err
+	}
+	if _, err = seg.w.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return flush(seg.w)
+}
+
+func (seg *segment) close() error {
+	err := seg.w.Close()
+	if seg.w != io.WriteCloser(seg.f) {
+		if cerr := seg.f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+func (s *spool) nextName() string {
+	s.seq++
+	return filepath.Join(s.dir, fmt.Sprintf("%020d-%06d%s", time.Now().UnixNano(), s.seq, spoolSuffix))
+}
+
+// append adds an event to the active segment, starting one if needed
+func (s *spool) append(event *cloudwatchlogs.InputLogEvent) error {
+	if s == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.active == nil {
+		seg, err := s.create(s.nextName())
+		if err != nil {
+			return err
+		}
+		s.active = seg
+	}
+	return s.active.write(event)
+}
+
+// rotate closes the active segment and returns its path, or "" if there
+// is none
+func (s *spool) rotate() string {
+	if s == nil {
+		return ""
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.active == nil {
+		return ""
+	}
+	name := s.active.f.Name()
+	s.active.close()
+	s.active = nil
+	return name
+}
+
+// writeSegment writes the events to a segment of their own
+func (s *spool) writeSegment(events []*cloudwatchlogs.InputLogEvent) (string, error) {
+	if s == nil {
+		return "", nil
+	}
+
+	s.mu.Lock()
+	name := s.nextName()
+	s.mu.Unlock()
+
+	seg, err := s.create(name)
+	if err != nil {
+		return "", err
+	}
+
+	for _, event := range events {
+		if err := seg.write(event); err != nil {
+			seg.close()
+			return name, err
+		}
+	}
+	if err := seg.f.Sync(); err != nil {
+		seg.close()
+		return name, err
+	}
+	return name, seg.close()
+}
+
+// remove deletes a delivered segment
+func (s *spool) remove(name string) {
+	if s == nil || name == "" {
+		return
+	}
+	os.Remove(name)
+}
+
+// segments lists leftover segments, oldest first
+func (s *spool) segments() ([]string, error) {
+	names, err := filepath.Glob(filepath.Join(s.dir, "*"+spoolSuffix))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// readSegment decodes a segment, detecting its compression from the header
+func (s *spool) readSegment(name string) ([]*cloudwatchlogs.InputLogEvent, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r, err := Decompress(f, s.codec)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var events []*cloudwatchlogs.InputLogEvent
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxSpoolLine)
+	for scanner.Scan() {
+		var line archivedEvent
+		// a torn last line from a crash is skipped rather than failing the replay
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			continue
+		}
+		events = append(events, &cloudwatchlogs.InputLogEvent{
+			Message:   aws.String(line.Message),
+			Timestamp: aws.Int64(line.Timestamp),
+		})
+	}
+	// a compressed segment cut short by a crash ends without its trailer
+	if err := scanner.Err(); err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return events, err
+	}
+	return events, nil
+}
+
+// replaySpool sends the segments a previous process left behind
+func (ch *CloudwatchHook) replaySpool() {
+	if ch.spool == nil {
+		return
+	}
+
+	names, err := ch.spool.segments()
+	if err != nil {
+		ch.reportError(err)
+		return
+	}
+	for _, name := range names {
+		events, err := ch.spool.readSegment(name)
+		if err != nil {
+			ch.reportError(err)
+			continue
+		}
+		if len(events) == 0 {
+			ch.spool.remove(name)
+			continue
+		}
+		ch.sendEvent(events, name)
+	}
+}
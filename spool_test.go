@@ -0,0 +1,95 @@
+package zapcloudwatch
+
+import (
+	"errors"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestSpoolReplay(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		codec Codec
+	}{
+		{"plain", nil},
+		{"gzip", GzipCodec{}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			// the first process can't deliver and leaves its events spooled
+			down := &memSink{}
+			down.fail(errors.New("network down"))
+			first := &CloudwatchHook{Sink: down, SpoolDir: dir, SpoolCodec: tt.codec, OnError: func(error) {}}
+			core, err := first.GetCore(zapcore.DebugLevel)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// the failed writes are expected
+			logger := zap.New(core, zap.ErrorOutput(zapcore.AddSync(io.Discard)))
+			logger.Info("one")
+			logger.Info("two", zap.Int("n", 2))
+			first.Close()
+
+			segments, err := (&spool{dir: dir}).segments()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(segments) == 0 {
+				t.Fatal("nothing was spooled")
+			}
+
+			// the next one replays them on setup
+			up := &memSink{}
+			second := &CloudwatchHook{Sink: up, SpoolDir: dir, SpoolCodec: tt.codec}
+			if _, err := second.GetCore(zapcore.DebugLevel); err != nil {
+				t.Fatal(err)
+			}
+			if err := second.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			want := []string{"[] one {}", `[] two {"n":2}`}
+			got := up.messages()
+			if len(got) != len(want) {
+				t.Fatalf("replayed %q, want %q", got, want)
+			}
+			for i := range want {
+				if got[i] != want[i] {
+					t.Errorf("event %d = %q, want %q", i, got[i], want[i])
+				}
+			}
+			if left, _ := (&spool{dir: dir}).segments(); len(left) != 0 {
+				t.Errorf("delivered segments left behind: %q", left)
+			}
+		})
+	}
+}
+
+func TestSpoolTornLine(t *testing.T) {
+	s := &spool{dir: t.TempDir()}
+	name, err := s.writeSegment([]*cloudwatchlogs.InputLogEvent{{Message: aws.String("kept"), Timestamp: aws.Int64(1)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(name, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"timestamp":1,"mess`)
+	f.Close()
+
+	got, err := s.readSegment(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || aws.StringValue(got[0].Message) != "kept" {
+		t.Fatalf("read %v, want the complete event only", got)
+	}
+}
@@ -0,0 +1,123 @@
+package zapcloudwatch
+
+import (
+	"sync/atomic"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+)
+
+// HookStats counts what a hook has done with its events since it was
+// created or its stats were last reset. Streams the hook routes to are
+// included, as are those it stopped routing to.
+type HookStats struct {
+	// Enqueued is the number of events accepted for delivery.
+	Enqueued int64
+	// Sent is the number of events delivered by successful puts.
+	Sent int64
+	// Failed is the number of events in failed puts.
+	Failed int64
+	// Retried is the number of calls made again after a throttling,
+	// transient or sequence token error.
+	Retried int64
+	// Dropped is the number of undelivered events that had no fallback to
+	// go to.
+	Dropped int64
+	// Bytes is the size of the messages delivered.
+	Bytes int64
+}
+
+// hookStats holds the counters behind HookStats
+type hookStats struct {
+	enqueued atomic.Int64
+	sent     atomic.Int64
+	failed   atomic.Int64
+	retried  atomic.Int64
+	dropped  atomic.Int64
+	bytes    atomic.Int64
+}
+
+// retry counts a call made again. It is safe on a nil *hookStats.
+func (s *hookStats) retry() {
+	if s != nil {
+		s.retried.Add(1)
+	}
+}
+
+// delivered counts events put successfully
+func (s *hookStats) delivered(events []*cloudwatchlogs.InputLogEvent) {
+	var size int64
+	for _, event := range events {
+		size += int64(len(aws.StringValue(event.Message)))
+	}
+	s.sent.Add(int64(len(events)))
+	s.bytes.Add(size)
+}
+
+// add adds the counts of stats
+func (s *hookStats) add(stats HookStats) {
+	s.enqueued.Add(stats.Enqueued)
+	s.sent.Add(stats.Sent)
+	s.failed.Add(stats.Failed)
+	s.retried.Add(stats.Retried)
+	s.dropped.Add(stats.Dropped)
+	s.bytes.Add(stats.Bytes)
+}
+
+// Stats returns a snapshot of the hook's counters
+func (ch *CloudwatchHook) Stats() HookStats {
+	// a reaped child's stats move to the parent under routes.mu, so they
+	// are counted once, either way
+	ch.routes.mu.Lock()
+	stats := HookStats{
+		Enqueued: ch.stats.enqueued.Load(),
+		Sent:     ch.stats.sent.Load(),
+		Failed:   ch.stats.failed.Load(),
+		Retried:  ch.stats.retried.Load(),
+		Dropped:  ch.stats.dropped.Load(),
+		Bytes:    ch.stats.bytes.Load(),
+	}
+	children := ch.routedAndClosing()
+	ch.routes.mu.Unlock()
+
+	for _, child := range children {
+		cs := child.Stats()
+		stats.Enqueued += cs.Enqueued
+		stats.Sent += cs.Sent
+		stats.Failed += cs.Failed
+		stats.Retried += cs.Retried
+		stats.Dropped += cs.Dropped
+		stats.Bytes += cs.Bytes
+	}
+	return stats
+}
+
+// ResetStats sets the hook's counters back to zero
+func (ch *CloudwatchHook) ResetStats() {
+	ch.routes.mu.Lock()
+	ch.stats.enqueued.Store(0)
+	ch.stats.sent.Store(0)
+	ch.stats.failed.Store(0)
+	ch.stats.retried.Store(0)
+	ch.stats.dropped.Store(0)
+	ch.stats.bytes.Store(0)
+	children := ch.routedAndClosing()
+	ch.routes.mu.Unlock()
+
+	for _, child := range children {
+		child.ResetStats()
+	}
+}
+
+// routedAndClosing returns the children routed to and those reaped but still
+// being closed. routes.mu must be held.
+func (ch *CloudwatchHook) routedAndClosing() []*CloudwatchHook {
+	children := make([]*CloudwatchHook, 0, ch.routes.lru.Len()+len(ch.routes.closing))
+	for el := ch.routes.lru.Front(); el != nil; el = el.Next() {
+		children = append(children, el.Value.(*route).hook)
+	}
+	for child := range ch.routes.closing {
+		children = append(children, child)
+	}
+	return children
+}
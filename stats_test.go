@@ -0,0 +1,72 @@
+package zapcloudwatch
+
+import (
+	"errors"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestStats(t *testing.T) {
+	sink := &memSink{}
+	hook := &CloudwatchHook{Sink: sink}
+	for _, msg := range []string{"one", "two"} {
+		if err := hook.write(zapcore.Entry{Level: zapcore.InfoLevel, Message: msg}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var size int64
+	for _, msg := range sink.messages() {
+		size += int64(len(msg))
+	}
+	sink.fail(errors.New("put failed"))
+	hook.write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "three"})
+
+	want := HookStats{Enqueued: 3, Sent: 2, Failed: 1, Dropped: 1, Bytes: size}
+	if got := hook.Stats(); got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	hook.ResetStats()
+	if got := hook.Stats(); got != (HookStats{}) {
+		t.Errorf("after reset got %+v, want zeros", got)
+	}
+}
+
+func TestStatsKeepReapedRoutes(t *testing.T) {
+	m := &mockLogs{}
+	hook := &CloudwatchHook{
+		GroupName:      "group",
+		StreamName:     "main",
+		Client:         m,
+		MaxRoutes:      1,
+		StreamNameFunc: func(e zapcore.Entry) string { return e.LoggerName },
+	}
+	core, err := hook.GetCore(zapcore.DebugLevel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := zap.New(core)
+
+	// each stream reaps the one before it
+	for _, stream := range []string{"a", "b", "c"} {
+		logger.Named(stream).Info("hi")
+		if got := hook.Stats(); got.Sent != 1 {
+			t.Fatalf("after %s sent %d, want 1", stream, got.Sent)
+		}
+		if err := hook.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		hook.ResetStats()
+	}
+
+	for _, stream := range []string{"a", "b", "c"} {
+		logger.Named(stream).Info("hi")
+	}
+	if err := hook.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := hook.Stats(); got.Enqueued != 3 || got.Sent != 3 {
+		t.Errorf("got %+v, want 3 enqueued and sent", got)
+	}
+}
@@ -0,0 +1,59 @@
+package zapcloudwatch
+
+import (
+	"sync"
+
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"go.uber.org/zap/zapcore"
+)
+
+// TestHook is a hook for tests that records entries in memory instead of
+// sending them anywhere. It works with GetHook, GetCore and the other ways
+// of writing to a hook:
+//
+//	hook := zapcloudwatch.NewTestHook()
+//	core, _ := hook.GetCore(zapcore.DebugLevel)
+//	zap.New(core).Info("hello", zap.Int("n", 1))
+//	hook.Recorded()[0].Message // hello {"n":1}
+type TestHook struct {
+	*CloudwatchHook
+
+	mu      sync.Mutex
+	entries []zapcore.Entry
+}
+
+// NewTestHook creates a TestHook accepting all levels
+func NewTestHook() *TestHook {
+	th := &TestHook{}
+	th.CloudwatchHook = &CloudwatchHook{Sink: discardSink{}}
+	th.record = th.add
+	return th
+}
+
+func (th *TestHook) add(e zapcore.Entry) {
+	th.mu.Lock()
+	defer th.mu.Unlock()
+	th.entries = append(th.entries, e)
+}
+
+// Recorded returns the entries written so far, oldest first, their
+// messages formatted with their fields
+func (th *TestHook) Recorded() []zapcore.Entry {
+	th.mu.Lock()
+	defer th.mu.Unlock()
+	return append([]zapcore.Entry(nil), th.entries...)
+}
+
+// Reset forgets the entries recorded so far
+func (th *TestHook) Reset() {
+	th.mu.Lock()
+	defer th.mu.Unlock()
+	th.entries = nil
+}
+
+// discardSink drops every event
+type discardSink struct{}
+
+func (discardSink) Put([]*cloudwatchlogs.InputLogEvent) error {
+	return nil
+}
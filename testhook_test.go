@@ -0,0 +1,48 @@
+package zapcloudwatch
+
+import (
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestTestHook(t *testing.T) {
+	hook := NewTestHook()
+	core, err := hook.GetCore(zapcore.DebugLevel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := zap.New(core).Named("api")
+	logger.Debug("starting")
+	logger.Warn("slow", zap.Int("ms", 900))
+
+	got := hook.Recorded()
+	if len(got) != 2 {
+		t.Fatalf("recorded %d entries, want 2", len(got))
+	}
+	want := []zapcore.Entry{
+		{Level: zapcore.DebugLevel, LoggerName: "api", Message: "starting {}"},
+		{Level: zapcore.WarnLevel, LoggerName: "api", Message: `slow {"ms":900}`},
+	}
+	for i, e := range got {
+		if e.Level != want[i].Level || e.LoggerName != want[i].LoggerName || e.Message != want[i].Message {
+			t.Errorf("entry %d is %v %q %q, want %v %q %q", i, e.Level, e.LoggerName, e.Message, want[i].Level, want[i].LoggerName, want[i].Message)
+		}
+	}
+
+	// Recorded returns a copy
+	got[0].Message = "changed"
+	if hook.Recorded()[0].Message == "changed" {
+		t.Error("changing what Recorded returned changed the hook's entries")
+	}
+
+	hook.Reset()
+	logger.Info("again")
+	if got := hook.Recorded(); len(got) != 1 || got[0].Message != "again {}" {
+		t.Errorf("after Reset recorded %q, want just the new entry", got)
+	}
+	if err := hook.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+}
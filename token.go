@@ -0,0 +1,55 @@
+package zapcloudwatch
+
+import (
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+// TokenStore persists the latest sequence token of each log stream
+type TokenStore interface {
+	// LoadToken returns the stored token, or nil if there is none.
+	LoadToken(group, stream string) (*string, error)
+	SaveToken(group, stream string, token *string) error
+}
+
+// FileTokenStore keeps each stream's token in a file under Dir
+type FileTokenStore struct {
+	Dir string
+}
+
+func (s FileTokenStore) path(group, stream string) string {
+	return filepath.Join(s.Dir, url.PathEscape(group)+"@"+url.PathEscape(stream)+".token")
+}
+
+func (s FileTokenStore) LoadToken(group, stream string) (*string, error) {
+	b, err := os.ReadFile(s.path(group, stream))
+	if errors.Is(err, os.ErrNotExist) || len(b) == 0 {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	token := string(b)
+	return &token, nil
+}
+
+func (s FileTokenStore) SaveToken(group, stream string, token *string) error {
+	if token == nil {
+		if err := os.Remove(s.path(group, stream)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	if err := os.MkdirAll(s.Dir, 0o700); err != nil {
+		return err
+	}
+
+	// write then rename so a crash never leaves a torn token behind
+	tmp := s.path(group, stream) + ".tmp"
+	if err := os.WriteFile(tmp, []byte(*token), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path(group, stream))
+}
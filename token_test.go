@@ -0,0 +1,57 @@
+package zapcloudwatch
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestFileTokenStore(t *testing.T) {
+	store := FileTokenStore{Dir: t.TempDir() + "/tokens"}
+
+	if token, err := store.LoadToken("app/web", "i-1:a"); err != nil || token != nil {
+		t.Fatalf("LoadToken of a missing token = %v, %v", token, err)
+	}
+	if err := store.SaveToken("app/web", "i-1:a", aws.String("49590")); err != nil {
+		t.Fatal(err)
+	}
+	if token, err := store.LoadToken("app/web", "i-1:a"); err != nil || aws.StringValue(token) != "49590" {
+		t.Fatalf("LoadToken = %v, %v, want the saved token", aws.StringValue(token), err)
+	}
+	if token, _ := store.LoadToken("app/web", "i-1:b"); token != nil {
+		t.Fatalf("another stream got token %q", *token)
+	}
+	if err := store.SaveToken("app/web", "i-1:a", nil); err != nil {
+		t.Fatal(err)
+	}
+	if token, err := store.LoadToken("app/web", "i-1:a"); err != nil || token != nil {
+		t.Fatalf("LoadToken after saving nil = %v, %v", token, err)
+	}
+}
+
+func TestTokenStoreFirstPut(t *testing.T) {
+	m := &mockLogs{checkTokens: true}
+	m.addStream("group", "stream")
+	m.streams["group/stream"] = "persisted"
+	store := FileTokenStore{Dir: t.TempDir()}
+	store.SaveToken("group", "stream", aws.String("persisted"))
+
+	hook := &CloudwatchHook{GroupName: "group", StreamName: "stream", Client: m, TokenStore: store}
+	if err := hook.AddMessage(zapcore.InfoLevel, "resumed"); err != nil {
+		t.Fatal(err)
+	}
+	hook.Close()
+
+	if n := m.count("PutLogEvents"); n != 1 {
+		t.Errorf("made %d puts, want the stored token to work the first time", n)
+	}
+	for _, op := range []string{"DescribeLogGroups", "DescribeLogStreams"} {
+		if n := m.count(op); n != 0 {
+			t.Errorf("made %d %s calls despite a stored token", n, op)
+		}
+	}
+	if token, _ := store.LoadToken("group", "stream"); aws.StringValue(token) != m.streams["group/stream"] {
+		t.Errorf("stored token %q, want the latest %q", aws.StringValue(token), m.streams["group/stream"])
+	}
+}
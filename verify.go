@@ -0,0 +1,129 @@
+package zapcloudwatch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+)
+
+// Problem is the kind of trouble Verify ran into
+type Problem int
+
+const (
+	// ProblemOther is anything not covered below, such as throttling.
+	ProblemOther Problem = iota
+	// ProblemCredentials means there are no credentials or they were rejected.
+	ProblemCredentials
+	// ProblemPermissions means the credentials lack a needed permission.
+	ProblemPermissions
+	// ProblemRegion means the region is missing or its endpoint unreachable.
+	ProblemRegion
+)
+
+func (p Problem) String() string {
+	switch p {
+	case ProblemCredentials:
+		return "credentials"
+	case ProblemPermissions:
+		return "permissions"
+	case ProblemRegion:
+		return "region"
+	}
+	return "other"
+}
+
+// VerifyError is returned by Verify, telling what kind of problem it found
+type VerifyError struct {
+	Problem Problem
+	// Op is the call that failed, e.g. DescribeLogGroups.
+	Op  string
+	Err error
+}
+
+func (e *VerifyError) Error() string {
+	return fmt.Sprintf("zapcloudwatch: %s failed (%s): %v", e.Op, e.Problem, e.Err)
+}
+
+func (e *VerifyError) Unwrap() error {
+	return e.Err
+}
+
+// Verify checks that the hook's credentials, region and permissions allow
+// describing its log group and stream, without creating either or sending
+// anything. With VerifyPut it checks puts too. It suits startup checks; a
+// failure is a *VerifyError.
+func (ch *CloudwatchHook) Verify(ctx context.Context) error {
+	svc := ch.Client
+	if svc == nil {
+		client, err := newClient(ch.awsConfig())
+		if err != nil {
+			return &VerifyError{Problem: problemOf(err), Op: "NewSession", Err: err}
+		}
+		svc = client
+	}
+
+	_, err := svc.DescribeLogGroupsWithContext(ctx, &cloudwatchlogs.DescribeLogGroupsInput{
+		LogGroupNamePrefix: aws.String(ch.GroupName),
+		Limit:              aws.Int64(1),
+	})
+	if err != nil {
+		return &VerifyError{Problem: problemOf(err), Op: "DescribeLogGroups", Err: err}
+	}
+
+	_, err = svc.DescribeLogStreamsWithContext(ctx, &cloudwatchlogs.DescribeLogStreamsInput{
+		LogGroupName:        aws.String(ch.GroupName),
+		LogStreamNamePrefix: aws.String(ch.StreamName),
+		Limit:               aws.Int64(1),
+	})
+	// a group that doesn't exist yet is created on first use
+	if err != nil && !isErrorCode(err, cloudwatchlogs.ErrCodeResourceNotFoundException) {
+		return &VerifyError{Problem: problemOf(err), Op: "DescribeLogStreams", Err: err}
+	}
+	if !ch.VerifyPut {
+		return nil
+	}
+
+	// permissions are checked before the stream is looked up, so an
+	// allowed put fails with ResourceNotFoundException instead
+	_, err = svc.PutLogEventsWithContext(ctx, &cloudwatchlogs.PutLogEventsInput{
+		LogGroupName:  aws.String(ch.GroupName),
+		LogStreamName: aws.String(fmt.Sprintf("zapcloudwatch-verify-%d", time.Now().UnixNano())),
+		LogEvents: []*cloudwatchlogs.InputLogEvent{{
+			Message:   aws.String("verify"),
+			Timestamp: aws.Int64(time.Now().UnixMilli()),
+		}},
+	})
+	if err != nil && !isErrorCode(err, cloudwatchlogs.ErrCodeResourceNotFoundException) {
+		return &VerifyError{Problem: problemOf(err), Op: "PutLogEvents", Err: err}
+	}
+	return nil
+}
+
+// problemOf sorts an AWS error into a Problem
+func problemOf(err error) Problem {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return ProblemRegion
+	}
+
+	var aerr awserr.Error
+	if !errors.As(err, &aerr) {
+		return ProblemOther
+	}
+	switch aerr.Code() {
+	case "NoCredentialProviders", "ExpiredToken", "ExpiredTokenException", "InvalidClientTokenId",
+		"UnrecognizedClientException", "SignatureDoesNotMatch", "IncompleteSignature":
+		return ProblemCredentials
+	case "AccessDeniedException", "AccessDenied", "UnauthorizedOperation":
+		return ProblemPermissions
+	case aws.ErrMissingRegion.Code(), aws.ErrMissingEndpoint.Code():
+		return ProblemRegion
+	}
+	return ProblemOther
+}
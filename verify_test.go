@@ -0,0 +1,53 @@
+package zapcloudwatch
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+)
+
+func TestVerify(t *testing.T) {
+	denied := func() error { return awserr.New("AccessDeniedException", "not allowed", nil) }
+	tests := []struct {
+		name    string
+		mock    *mockLogs
+		put     bool
+		op      string
+		problem Problem
+	}{
+		{"allowed", &mockLogs{}, true, "", 0},
+		{"describe denied", &mockLogs{onDescribeGroups: denied}, false, "DescribeLogGroups", ProblemPermissions},
+		{"bad credentials", &mockLogs{onDescribeGroups: func() error {
+			return awserr.New("UnrecognizedClientException", "bad token", nil)
+		}}, false, "DescribeLogGroups", ProblemCredentials},
+		{"streams denied", &mockLogs{onDescribeStreams: denied}, false, "DescribeLogStreams", ProblemPermissions},
+		{"put not checked", &mockLogs{onPut: func(*cloudwatchlogs.PutLogEventsInput) error { return denied() }}, false, "", 0},
+		{"put denied", &mockLogs{onPut: func(*cloudwatchlogs.PutLogEventsInput) error { return denied() }}, true, "PutLogEvents", ProblemPermissions},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ch := &CloudwatchHook{Client: tt.mock, GroupName: "g", StreamName: "s", VerifyPut: tt.put}
+			err := ch.Verify(context.Background())
+			if tt.op == "" {
+				if err != nil {
+					t.Fatalf("got %v, want nil", err)
+				}
+			} else {
+				var verr *VerifyError
+				if !errors.As(err, &verr) {
+					t.Fatalf("got %v, want a *VerifyError", err)
+				}
+				if verr.Op != tt.op || verr.Problem != tt.problem {
+					t.Errorf("got %s (%s), want %s (%s)", verr.Op, verr.Problem, tt.op, tt.problem)
+				}
+			}
+			// nothing is created or written
+			if n := tt.mock.count("CreateLogGroup") + tt.mock.count("CreateLogStream") + len(tt.mock.putInputs()); n != 0 {
+				t.Errorf("made %d creates or puts", n)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package zapcloudwatch
+
+import (
+	"io"
+	"strings"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// hookWriter turns every Write into one event at a fixed level
+type hookWriter struct {
+	hook  *CloudwatchHook
+	level zapcore.Level
+}
+
+// NewWriter returns an io.Writer that sends each Write as a single event,
+// going through the same buffering and delivery as zap entries. It lets the
+// stdlib logger ship to cloudwatch:
+//
+//	log.SetOutput(hook.NewWriter(zapcore.InfoLevel))
+//
+// The log group and stream are set up on the first write if GetHook or
+// GetCore haven't done so already.
+func (ch *CloudwatchHook) NewWriter(level zapcore.Level) io.Writer {
+	return &hookWriter{hook: ch, level: level}
+}
+
+func (w *hookWriter) Write(p []byte) (int, error) {
+	msg := strings.TrimSuffix(string(p), "\n")
+	err := w.hook.writeEntry(zapcore.Entry{
+		Level:   w.level,
+		Time:    time.Now(),
+		Message: msg,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// AddEntry sends an entry through the hook's usual buffering and delivery
+// without going through zap. With FormatText its message is sent as is,
+// followed by the hook's own fields, such as SourceTag, if it has any. An
+// entry without a time is given the current one.
+func (ch *CloudwatchHook) AddEntry(entry zapcore.Entry) error {
+	return ch.writeEntry(entry)
+}
+
+// AddMessage sends a message at the given level, like AddEntry
+func (ch *CloudwatchHook) AddMessage(level zapcore.Level, msg string) error {
+	return ch.AddEntry(zapcore.Entry{Level: level, Time: time.Now(), Message: msg})
+}
@@ -0,0 +1,128 @@
+package zapcloudwatch
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestNewWriterStdlibLog(t *testing.T) {
+	m := &mockLogs{}
+	hook := &CloudwatchHook{GroupName: "group", StreamName: "stream", Client: m, BatchSize: 10}
+	if _, err := hook.GetHook(); err != nil {
+		t.Fatal(err)
+	}
+	logger := log.New(hook.NewWriter(zapcore.WarnLevel), "legacy: ", 0)
+
+	logger.Println("disk almost full")
+	logger.Printf("retrying in %ds", 5)
+	logger.Print("multi\nline")
+	if err := hook.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"[] legacy: disk almost full", "[] legacy: retrying in 5s", "[] legacy: multi\nline"}
+	got := m.messages("group", "stream")
+	if len(got) != len(want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("event %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+	if n := m.count("PutLogEvents"); n != 1 {
+		t.Errorf("made %d puts, want one batch", n)
+	}
+}
+
+func TestNewWriterLevel(t *testing.T) {
+	sink := &memSink{}
+	hook := &CloudwatchHook{Sink: sink, AcceptedLevels: LevelThreshold(zapcore.ErrorLevel)}
+	if _, err := hook.GetHook(); err != nil {
+		t.Fatal(err)
+	}
+	w := hook.NewWriter(zapcore.InfoLevel)
+
+	if n, err := w.Write([]byte("filtered\n")); err != nil || n != 9 {
+		t.Fatalf("Write = %d, %v", n, err)
+	}
+	if msgs := sink.messages(); len(msgs) != 0 {
+		t.Fatalf("a level the hook doesn't accept was sent: %q", msgs)
+	}
+}
+
+func TestAddEntry(t *testing.T) {
+	m := &mockLogs{}
+	hook := &CloudwatchHook{GroupName: "group", StreamName: "stream", Client: m, BatchSize: 10, AcceptedLevels: LevelThreshold(zapcore.InfoLevel)}
+
+	if err := hook.AddEntry(zapcore.Entry{Level: zapcore.InfoLevel, LoggerName: "jobs", Message: "started"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := hook.AddMessage(zapcore.WarnLevel, "slow"); err != nil {
+		t.Fatal(err)
+	}
+	if err := hook.AddMessage(zapcore.DebugLevel, "filtered"); err != nil {
+		t.Fatal(err)
+	}
+	if err := hook.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"[jobs] started", "[] slow"}
+	got := m.messages("group", "stream")
+	if len(got) != len(want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("event %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+	for _, in := range m.putInputs() {
+		for _, e := range in.LogEvents {
+			if aws.Int64Value(e.Timestamp) == 0 {
+				t.Errorf("event %q has no timestamp", aws.StringValue(e.Message))
+			}
+		}
+	}
+	if err := hook.AddMessage(zapcore.InfoLevel, "late"); err != ErrClosed {
+		t.Errorf("AddMessage after close = %v, want ErrClosed", err)
+	}
+}
+
+func TestSourceTagOutsideCore(t *testing.T) {
+	sink := &memSink{}
+	hook := &CloudwatchHook{Sink: sink, SourceTag: "payments"}
+	write, err := hook.GetHook()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hook.AddMessage(zapcore.InfoLevel, "added")
+	fmt.Fprintln(hook.NewWriter(zapcore.InfoLevel), "written")
+	zap.New(zapcore.NewCore(zapcore.NewJSONEncoder(zapcore.EncoderConfig{}), zapcore.AddSync(io.Discard), zapcore.InfoLevel), zap.Hooks(write)).Info("hooked")
+	hook.Close()
+
+	want := []string{`[] added {"source":"payments"}`, `[] written {"source":"payments"}`, `[] hooked {"source":"payments"}`}
+	got := sink.messages()
+	if fmt.Sprintf("%q", got) != fmt.Sprintf("%q", want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestLoggerNameFieldOutsideCore(t *testing.T) {
+	sink := &memSink{}
+	hook := &CloudwatchHook{Sink: sink, LoggerName: LoggerNameField}
+	hook.AddEntry(zapcore.Entry{Level: zapcore.InfoLevel, LoggerName: "jobs", Message: "started"})
+	hook.Close()
+
+	if got := sink.messages(); len(got) != 1 || got[0] != `started {"logger":"jobs"}` {
+		t.Errorf("got %q, want the logger name as a field", got)
+	}
+}